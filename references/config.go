@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ── 設定ファイル ─────────────────────────────────────────────────
+//
+// $XDG_CONFIG_HOME/lightsout/config.json (Windows では %AppData%\lightsout\
+// config.json) に盤面サイズの既定値・配色・キーバインドを保存する。存在
+// しない場合は初回起動時に defaultConfig() の内容を書き出す。gameKey は
+// 'h'/'j'/'k'/'l' や矢印キーを直書きする代わりに、ここで読み込んだ
+// KeyBindings を keymap() で引いたアクション名を介して移動・トグルを解決
+// するため、ユーザは vim スタイルや WASD、矢印キーを再コンパイルせずに
+// 好きに割り当てられる。
+
+// Theme はゲーム盤面の配色 (ANSI エスケープシーケンス)。
+type Theme struct {
+	OnCell  string `json:"on_cell"`
+	OffCell string `json:"off_cell"`
+	Cursor  string `json:"cursor"`
+}
+
+// KeyBindings はアクション名ごとに受理するキー名の集合。キー名は
+// "space"/"enter" の特殊名か、矢印キーを表す "arrow_up"/"arrow_down"/
+// "arrow_left"/"arrow_right"、またはそれ以外の印字可能 ASCII 文字1文字
+// そのもの (例: "k", "w")。
+type KeyBindings struct {
+	Toggle []string `json:"toggle"`
+	Up     []string `json:"up"`
+	Down   []string `json:"down"`
+	Left   []string `json:"left"`
+	Right  []string `json:"right"`
+}
+
+// Config は config.json の中身。
+type Config struct {
+	DefaultRows    int         `json:"default_rows"`
+	DefaultCols    int         `json:"default_cols"`
+	HistoryCap     int         `json:"history_cap"` // undo/redo 履歴の環状バッファの上限件数。0 以下なら historyCapDefault を使う
+	Theme          Theme       `json:"theme"`
+	Keys           KeyBindings `json:"keys"`
+	SSHHostKeyPath string      `json:"ssh_host_key_path"` // -serve で使うホスト鍵ファイル。空文字列ならセッションごとに使い捨ての鍵を生成する
+}
+
+// defaultConfig は config.json が存在しない場合に書き出し、かつ使われる
+// 既定値。従来の盤面サイズ無指定・hjkl+矢印・既存の配色と互換になるよう
+// 選んである。
+func defaultConfig() Config {
+	return Config{
+		DefaultRows: 5,
+		DefaultCols: 5,
+		HistoryCap:  historyCapDefault,
+		Theme: Theme{
+			OnCell:  ansiYellow,
+			OffCell: ansiGray,
+			Cursor:  ansiYellowBG,
+		},
+		Keys: KeyBindings{
+			Toggle: []string{"space", "enter"},
+			Up:     []string{"k", "arrow_up"},
+			Down:   []string{"j", "arrow_down"},
+			Left:   []string{"h", "arrow_left"},
+			Right:  []string{"l", "arrow_right"},
+		},
+	}
+}
+
+// configFilePath はリーダーボード等と同じ XDG の流儀で設定ファイルの
+// 保存先を返す。
+func configFilePath() (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "lightsout", "config.json"), nil
+}
+
+// loadConfig は config.json を読み込む。存在しなければ defaultConfig() を
+// 書き出したうえでそれを返す。
+func loadConfig() (Config, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return defaultConfig(), err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		cfg := defaultConfig()
+		if err := cfg.save(path); err != nil {
+			return cfg, err
+		}
+		return cfg, nil
+	}
+	if err != nil {
+		return defaultConfig(), err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return defaultConfig(), err
+	}
+	return cfg, nil
+}
+
+func (c Config) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// reservedKeyNames は gameKey の固定の switch ch が既に意味を持たせている
+// 一文字キーの集合。keymap() はここに含まれる名前を黙って割り当てず、
+// リスタートや解析スクランブルのような既存のホットキーがユーザ設定の
+// 移動/トグル割り当てに横取りされてしまうのを防ぐ。
+var reservedKeyNames = map[string]bool{
+	"q": true, "Q": true,
+	"y": true,
+	"u": true, "U": true,
+	"g": true, "G": true,
+	"s": true, "S": true,
+	"L": true,
+	"c": true, "C": true,
+	"a": true, "A": true,
+	"t": true, "T": true,
+	"e": true, "E": true,
+	"r": true, "R": true,
+	"H": true,
+	"p": true, "P": true,
+	`\`: true,
+}
+
+// keymap はキー名 ("k", "arrow_up", "space", ...) からアクション名
+// ("up"/"down"/"left"/"right"/"toggle") への逆引きテーブルを作る。
+// reservedKeyNames に含まれる名前は固定ホットキーを壊さないよう無視し、
+// 標準エラー出力に警告を出す。
+func (c Config) keymap() map[string]string {
+	m := make(map[string]string)
+	add := func(action string, names []string) {
+		for _, n := range names {
+			if reservedKeyNames[n] {
+				fmt.Fprintf(os.Stderr, "config.json: \"%s\" はゲーム操作の固定キーのため %s には割り当てられません\n", n, action)
+				continue
+			}
+			m[n] = action
+		}
+	}
+	add("toggle", c.Keys.Toggle)
+	add("up", c.Keys.Up)
+	add("down", c.Keys.Down)
+	add("left", c.Keys.Left)
+	add("right", c.Keys.Right)
+	return m
+}
+
+// keyName は gameKey が受け取った生バイト列を keymap 照合用のキー名へ
+// 変換する。対応しないシーケンスは空文字列を返す。
+func keyName(b []byte) string {
+	switch {
+	case len(b) == 1 && b[0] == ' ':
+		return "space"
+	case len(b) == 1 && (b[0] == '\r' || b[0] == '\n'):
+		return "enter"
+	case len(b) >= 3 && b[0] == 27 && b[1] == '[':
+		switch b[2] {
+		case 'A':
+			return "arrow_up"
+		case 'B':
+			return "arrow_down"
+		case 'C':
+			return "arrow_right"
+		case 'D':
+			return "arrow_left"
+		}
+		return ""
+	case len(b) == 1 && b[0] >= 32 && b[0] < 127:
+		return string(b[0])
+	default:
+		return ""
+	}
+}
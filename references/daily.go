@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ── デイリーチャレンジ ───────────────────────────────────────────
+//
+// メニューの "D" で選べる「本日のチャレンジ」は、日付と盤面サイズから
+// sha256 で導いた決定的なシードを使って盤面を生成するため、同じ日に
+// 同じサイズで挑戦した人は誰でも全く同じ盤面になる。結果 (手数・経過秒数)
+// は $XDG_STATE_HOME/lightsout/daily.json に (日付, rows, cols) ごとの
+// ベスト記録として蓄積され、連続達成日数 (streak) を数えるのに使われる。
+
+// dailySeed は日付文字列 (YYYY-MM-DD) と盤面サイズから rand.Source 用の
+// 決定的なシードを導く。
+func dailySeed(date string, rows, cols int) int64 {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", date, rows, cols)))
+	return int64(binary.BigEndian.Uint64(h[:8]))
+}
+
+// dailyResult はデイリーチャレンジ1回分のベスト記録 (日付・盤面サイズごと)。
+type dailyResult struct {
+	Date    string  `json:"date"`
+	Rows    int     `json:"rows"`
+	Cols    int     `json:"cols"`
+	Moves   int     `json:"moves"`
+	Seconds float64 `json:"seconds"`
+}
+
+// dailyLeaderboard は daily.json の中身そのもの。
+type dailyLeaderboard struct {
+	Results []dailyResult `json:"results"`
+}
+
+// dailyFilePath はリーダーボードの保存先を返す。state.json と同じ
+// $XDG_STATE_HOME/lightsout/ 以下に置く。
+func dailyFilePath() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "lightsout", "daily.json"), nil
+}
+
+// loadDailyLeaderboard は daily.json を読み込む。ファイルが存在しない場合は
+// 空のリーダーボードを返す (初回プレイ時のエラー扱いを避けるため)。
+func loadDailyLeaderboard() (dailyLeaderboard, error) {
+	path, err := dailyFilePath()
+	if err != nil {
+		return dailyLeaderboard{}, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return dailyLeaderboard{}, nil
+	}
+	if err != nil {
+		return dailyLeaderboard{}, err
+	}
+	var lb dailyLeaderboard
+	if err := json.Unmarshal(data, &lb); err != nil {
+		return dailyLeaderboard{}, err
+	}
+	return lb, nil
+}
+
+func (lb dailyLeaderboard) save() error {
+	path, err := dailyFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lb, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// recordDailyResult は (date, rows, cols) のベスト記録を更新し、その盤面
+// サイズでの連続達成日数を返す。手数が少ないほど、同手数なら経過秒数が
+// 短いほど良い記録として上書きする。
+func recordDailyResult(date string, rows, cols, moves int, elapsed time.Duration) (best dailyResult, streak int, err error) {
+	lb, err := loadDailyLeaderboard()
+	if err != nil {
+		return dailyResult{}, 0, err
+	}
+
+	seconds := elapsed.Seconds()
+	found := false
+	for i, r := range lb.Results {
+		if r.Date == date && r.Rows == rows && r.Cols == cols {
+			if moves < r.Moves || (moves == r.Moves && seconds < r.Seconds) {
+				lb.Results[i].Moves = moves
+				lb.Results[i].Seconds = seconds
+			}
+			best = lb.Results[i]
+			found = true
+			break
+		}
+	}
+	if !found {
+		best = dailyResult{Date: date, Rows: rows, Cols: cols, Moves: moves, Seconds: seconds}
+		lb.Results = append(lb.Results, best)
+	}
+
+	if err := lb.save(); err != nil {
+		return best, 0, err
+	}
+	return best, dailyStreak(lb, rows, cols, date), nil
+}
+
+// dailyStreak は date を最終日として、同じ盤面サイズで記録が連続して
+// 存在する日数を数える。
+func dailyStreak(lb dailyLeaderboard, rows, cols int, date string) int {
+	played := make(map[string]bool, len(lb.Results))
+	for _, r := range lb.Results {
+		if r.Rows == rows && r.Cols == cols {
+			played[r.Date] = true
+		}
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0
+	}
+	streak := 0
+	for played[t.AddDate(0, 0, -streak).Format("2006-01-02")] {
+		streak++
+	}
+	return streak
+}
+
+// dailyStreakToday はメニュー表示用に、今日を最終日とした連続達成日数を返す。
+// daily.json が読めない場合は単に 0 を返す (メニュー描画を失敗させない)。
+func dailyStreakToday(rows, cols int) int {
+	lb, err := loadDailyLeaderboard()
+	if err != nil {
+		return 0
+	}
+	return dailyStreak(lb, rows, cols, time.Now().Format("2006-01-02"))
+}
+
+// printDailyJSON は --daily-json フラグ用に、本日分のデイリー記録を
+// JSON 配列として標準出力に書き出す (外部集計用)。
+func printDailyJSON() error {
+	lb, err := loadDailyLeaderboard()
+	if err != nil {
+		return err
+	}
+	today := time.Now().Format("2006-01-02")
+	todays := make([]dailyResult, 0, len(lb.Results))
+	for _, r := range lb.Results {
+		if r.Date == today {
+			todays = append(todays, r)
+		}
+	}
+	data, err := json.MarshalIndent(todays, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
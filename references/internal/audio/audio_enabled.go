@@ -0,0 +1,120 @@
+//go:build audio
+
+// Package audio は盤面操作に合わせて短い効果音を鳴らす、最小限の仕組みを
+// 提供する。スピーカーの初期化やデコードに失敗しても (ヘッドレス環境・CI・
+// 音声デバイスの無い SSH サーバホスト等) ゲーム本体には一切影響しないよう、
+// Play はすべて黙って失敗する設計になっている。
+//
+// faiface/beep の Linux 向けスピーカー実装は ALSA ヘッダ (libasound2-dev)
+// へのリンクを必要とし、入っていない環境ではそもそもビルドが通らない。
+// それでは「ヘッドレス環境でも動く」という本来の狙いと矛盾するため、この
+// 実装は `-tags audio` を指定したときだけビルドに入る。既定のビルドでは
+// audio_stub.go の無音実装が使われ、ALSA 等のシステム依存は一切不要。
+package audio
+
+import (
+	"bytes"
+	"embed"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+	"github.com/faiface/beep/wav"
+)
+
+//go:embed assets/*.wav
+var assets embed.FS
+
+// Event は Play に渡すゲームイベント名。
+type Event string
+
+const (
+	EventToggle  Event = "toggle"   // セルをトグルした
+	EventClear   Event = "clear"    // 全消灯してクリアした
+	EventInvalid Event = "invalid"  // クリア済みの盤面でのトグル等、無効な操作
+	EventOver    Event = "gameover" // 敗北状態 (現状のひとり用ルールには無いが、将来の制限時間/ライフ制モード向けに予約)
+)
+
+var clipPaths = map[Event]string{
+	EventToggle:  "assets/toggle.wav",
+	EventClear:   "assets/clear.wav",
+	EventInvalid: "assets/invalid.wav",
+	EventOver:    "assets/gameover.wav",
+}
+
+type player struct {
+	initOnce sync.Once
+	mu       sync.Mutex
+	muted    bool
+	ready    bool
+	buffers  map[Event]*beep.Buffer
+}
+
+var p = &player{}
+
+// Mute は以後の Play をすべて無効化する。--mute フラグから呼ばれる。
+func Mute() {
+	p.mu.Lock()
+	p.muted = true
+	p.mu.Unlock()
+}
+
+// Play は event に対応する効果音を鳴らす。ミュート中、スピーカーの初期化に
+// 失敗した環境、対応するクリップが無い event では何もしない。呼び出し側で
+// エラーを気にする必要はない。
+func Play(event Event) {
+	p.mu.Lock()
+	muted := p.muted
+	p.mu.Unlock()
+	if muted {
+		return
+	}
+
+	p.initOnce.Do(p.init)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.ready {
+		return
+	}
+	buf, ok := p.buffers[event]
+	if !ok {
+		return
+	}
+	speaker.Play(buf.Streamer(0, buf.Len()))
+}
+
+// init はスピーカーと埋め込み済み WAV クリップのデコードを一度だけ遅延して
+// 行う。どこかで失敗しても ready を false のままにし、以後の Play が
+// 静かに無視するようにする (パニックも os.Exit もしない)。
+func (p *player) init() {
+	p.buffers = make(map[Event]*beep.Buffer)
+
+	var format beep.Format
+	for event, path := range clipPaths {
+		data, err := assets.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		streamer, f, err := wav.Decode(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		if format.SampleRate == 0 {
+			format = f
+		}
+		buf := beep.NewBuffer(f)
+		buf.Append(streamer)
+		_ = streamer.Close()
+		p.buffers[event] = buf
+	}
+
+	if len(p.buffers) == 0 || format.SampleRate == 0 {
+		return
+	}
+	if err := speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/20)); err != nil {
+		return
+	}
+	p.ready = true
+}
@@ -0,0 +1,25 @@
+//go:build !audio
+
+// Package audio は盤面操作に合わせて短い効果音を鳴らす、最小限の仕組みを
+// 提供する。既定のビルドでは、どんなシステムライブラリも必要としないこの
+// 無音実装が使われる (ALSA 等のオーディオバックエンドを要求する実装は
+// `-tags audio` を付けたビルドでのみ audio_enabled.go に差し替わる)。
+// Mute/Play のシグネチャは audio_enabled.go と同じなので、呼び出し側
+// (main.go) はどちらのビルドでも変更不要。
+package audio
+
+// Event は Play に渡すゲームイベント名。
+type Event string
+
+const (
+	EventToggle  Event = "toggle"   // セルをトグルした
+	EventClear   Event = "clear"    // 全消灯してクリアした
+	EventInvalid Event = "invalid"  // クリア済みの盤面でのトグル等、無効な操作
+	EventOver    Event = "gameover" // 敗北状態 (現状のひとり用ルールには無いが、将来の制限時間/ライフ制モード向けに予約)
+)
+
+// Mute は無音ビルドでは何もしない。
+func Mute() {}
+
+// Play は無音ビルドでは何もしない。
+func Play(event Event) {}
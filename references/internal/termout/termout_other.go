@@ -0,0 +1,14 @@
+//go:build !windows
+
+// Package termout は、VT100 処理に対応しないレガシーな Windows コンソール
+// でも lightsout の画面が崩れないよう、出力ライターを包んで CSI シーケンス
+// を端末固有の呼び出しに翻訳する。Unix 系端末はそのまま CSI を解釈できる
+// ため、このファイルでは何もしない。
+package termout
+
+import "io"
+
+// Wrap はこのプラットフォームでは w をそのまま返す。
+func Wrap(w io.Writer) io.Writer {
+	return w
+}
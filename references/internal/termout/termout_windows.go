@@ -0,0 +1,266 @@
+//go:build windows
+
+// Package termout は、VT100 処理に対応しないレガシーな Windows コンソール
+// でも lightsout の画面が崩れないよう、出力ライターを包んで CSI シーケンス
+// を端末固有の呼び出しに翻訳する。
+//
+// まず ENABLE_VIRTUAL_TERMINAL_PROCESSING の有効化を試み、成功すれば
+// (Windows 10 1511 以降など) CSI シーケンスをそのまま素通しする。有効化に
+// 失敗した場合のみ、shiena/ansicolor にならって SGR/カーソル制御の CSI を
+// SetConsoleTextAttribute/SetConsoleCursorPosition 等の Win32 呼び出しに
+// その場で翻訳する ansiTranslator で包む。lightsout が実際に出力する CSI
+// は限られているため、翻訳対象も SGR・カーソル移動・画面消去・カーソル
+// 表示/非表示のみに絞っている。
+package termout
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode             = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode             = kernel32.NewProc("SetConsoleMode")
+	procSetConsoleTextAttribute    = kernel32.NewProc("SetConsoleTextAttribute")
+	procSetConsoleCursorPosition   = kernel32.NewProc("SetConsoleCursorPosition")
+	procSetConsoleCursorInfo       = kernel32.NewProc("SetConsoleCursorInfo")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procFillConsoleOutputCharacter = kernel32.NewProc("FillConsoleOutputCharacterW")
+	procFillConsoleOutputAttribute = kernel32.NewProc("FillConsoleOutputAttributeW")
+)
+
+type coord struct{ x, y int16 }
+
+// packed は COORD を Win32 の呼び出し規約 (下位 16bit が X、上位 16bit が Y)
+// に従って1ワードへ詰め、構造体を値渡しする SetConsoleCursorPosition 等に
+// そのまま渡せるようにする。
+func (c coord) packed() uintptr {
+	return uintptr(uint32(uint16(c.y))<<16 | uint32(uint16(c.x)))
+}
+
+type smallRect struct{ left, top, right, bottom int16 }
+
+type consoleScreenBufferInfo struct {
+	size              coord
+	cursorPosition    coord
+	attributes        uint16
+	window            smallRect
+	maximumWindowSize coord
+}
+
+type consoleCursorInfo struct {
+	size    uint32
+	visible int32
+}
+
+const (
+	fgBlue      = 0x0001
+	fgGreen     = 0x0002
+	fgRed       = 0x0004
+	fgIntensity = 0x0008
+	bgBlue      = 0x0010
+	bgGreen     = 0x0020
+	bgRed       = 0x0040
+	bgIntensity = 0x0080
+
+	defaultAttr = fgBlue | fgGreen | fgRed // 既定の白文字・黒背景
+)
+
+// Wrap は w が *os.File であれば ENABLE_VIRTUAL_TERMINAL_PROCESSING を
+// まず試み、成功すればそのまま w を返す。失敗した場合は CSI シーケンスを
+// 翻訳する ansiTranslator で包む。*os.File 以外はコンソールではないと
+// みなしそのまま返す。
+func Wrap(w io.Writer) io.Writer {
+	f, ok := w.(*os.File)
+	if !ok {
+		return w
+	}
+	handle := syscall.Handle(f.Fd())
+	if enableVirtualTerminal(handle) {
+		return w
+	}
+	return &ansiTranslator{out: f, handle: handle, attr: defaultAttr}
+}
+
+func enableVirtualTerminal(handle syscall.Handle) bool {
+	var mode uint32
+	if r, _, _ := procGetConsoleMode.Call(uintptr(handle), uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return false
+	}
+	mode |= enableVirtualTerminalProcessing
+	r, _, _ := procSetConsoleMode.Call(uintptr(handle), uintptr(mode))
+	return r != 0
+}
+
+// ansiTranslator は CSI シーケンスを解釈しながら書き込む io.Writer。
+// 素のテキストはそのまま書き込み、"ESC [ ... <final>" だけを Win32
+// コンソール API に変換する。
+type ansiTranslator struct {
+	out    *os.File
+	handle syscall.Handle
+	attr   uint16 // 現在の SetConsoleTextAttribute 相当の属性
+}
+
+func (t *ansiTranslator) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, 0x1b)
+		if i < 0 {
+			if _, err := t.out.Write(p); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if i > 0 {
+			if _, err := t.out.Write(p[:i]); err != nil {
+				return 0, err
+			}
+		}
+		p = p[i:]
+		n := t.consumeEscape(p)
+		if n == 0 {
+			// 不完全なシーケンス: そのまま素通しして諦める
+			if _, err := t.out.Write(p); err != nil {
+				return 0, err
+			}
+			break
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// consumeEscape は p の先頭にある ESC [ ... <final> を解釈し、消費した
+// バイト数を返す (未完了なら 0)。
+func (t *ansiTranslator) consumeEscape(p []byte) int {
+	if len(p) < 2 || p[0] != 0x1b || p[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(p); i++ {
+		if (p[i] >= '0' && p[i] <= '9') || p[i] == ';' || p[i] == '?' {
+			continue
+		}
+		t.applyCSI(string(p[2:i]), p[i])
+		return i + 1
+	}
+	return 0
+}
+
+func (t *ansiTranslator) applyCSI(params string, final byte) {
+	switch final {
+	case 'm':
+		t.applySGR(params)
+	case 'H', 'f':
+		t.setCursor(0, 0)
+	case 'J':
+		if params == "" || params == "2" {
+			t.clearScreen()
+		}
+	case 'l':
+		if params == "?25" {
+			t.setCursorVisible(false)
+		}
+	case 'h':
+		if params == "?25" {
+			t.setCursorVisible(true)
+		}
+	}
+}
+
+func (t *ansiTranslator) applySGR(params string) {
+	if params == "" {
+		params = "0"
+	}
+	for _, part := range strings.Split(params, ";") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 0:
+			t.attr = defaultAttr
+		case n == 1:
+			t.attr |= fgIntensity
+		case n == 7:
+			t.attr = swapForeBack(t.attr)
+		case n >= 30 && n <= 37:
+			t.attr = (t.attr &^ (fgRed | fgGreen | fgBlue)) | ansiFore(n-30)
+		case n >= 90 && n <= 97:
+			t.attr = (t.attr &^ (fgRed | fgGreen | fgBlue)) | ansiFore(n-90) | fgIntensity
+		case n >= 40 && n <= 47:
+			t.attr = (t.attr &^ (bgRed | bgGreen | bgBlue)) | ansiBack(n-40)
+		case n >= 100 && n <= 107:
+			t.attr = (t.attr &^ (bgRed | bgGreen | bgBlue)) | ansiBack(n-100) | bgIntensity
+		}
+	}
+	procSetConsoleTextAttribute.Call(uintptr(t.handle), uintptr(t.attr))
+}
+
+// ansiFore は ANSI の 0-7 (黒/赤/緑/黄/青/マゼンタ/シアン/白) を
+// Win32 コンソールの前景ビットに変換する。
+func ansiFore(n int) uint16 {
+	var a uint16
+	if n&1 != 0 {
+		a |= fgRed
+	}
+	if n&2 != 0 {
+		a |= fgGreen
+	}
+	if n&4 != 0 {
+		a |= fgBlue
+	}
+	return a
+}
+
+func ansiBack(n int) uint16 {
+	var a uint16
+	if n&1 != 0 {
+		a |= bgRed
+	}
+	if n&2 != 0 {
+		a |= bgGreen
+	}
+	if n&4 != 0 {
+		a |= bgBlue
+	}
+	return a
+}
+
+func swapForeBack(attr uint16) uint16 {
+	fore := attr & 0x000f
+	back := (attr & 0x00f0) >> 4
+	return (fore << 4) | back
+}
+
+func (t *ansiTranslator) setCursor(row, col int16) {
+	c := coord{x: col, y: row}
+	procSetConsoleCursorPosition.Call(uintptr(t.handle), c.packed())
+}
+
+func (t *ansiTranslator) setCursorVisible(visible bool) {
+	info := consoleCursorInfo{size: 25}
+	if visible {
+		info.visible = 1
+	}
+	procSetConsoleCursorInfo.Call(uintptr(t.handle), uintptr(unsafe.Pointer(&info)))
+}
+
+func (t *ansiTranslator) clearScreen() {
+	var info consoleScreenBufferInfo
+	if r, _, _ := procGetConsoleScreenBufferInfo.Call(uintptr(t.handle), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return
+	}
+	size := uint32(info.size.x) * uint32(info.size.y)
+	var written uint32
+	procFillConsoleOutputCharacter.Call(uintptr(t.handle), uintptr(' '), uintptr(size), coord{}.packed(), uintptr(unsafe.Pointer(&written)))
+	procFillConsoleOutputAttribute.Call(uintptr(t.handle), uintptr(t.attr), uintptr(size), coord{}.packed(), uintptr(unsafe.Pointer(&written)))
+	t.setCursor(0, 0)
+}
@@ -0,0 +1,179 @@
+package tui
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyType はデコード済みキー入力の種別。
+type KeyType int
+
+const (
+	KeyRune KeyType = iota
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyEnter
+	KeyBackspace
+	KeyTab
+	KeyEscape
+	KeyCtrlC
+	KeyCtrlD
+	KeyFunction
+	KeyMouse
+	KeyUnknown
+)
+
+// MouseButton は KeyMouse イベントに付随するボタン種別。
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	MouseRelease
+	MouseWheelUp
+	MouseWheelDown
+)
+
+// Key は1回分の入力イベントをデコードした結果。Raw には読み取った生の
+// バイト列をそのまま保持しており、デコード結果では表現しきれない独自の
+// キー処理が必要な Model は Raw を直接見てもよい。
+type Key struct {
+	Type   KeyType
+	Rune   rune
+	FnNum  int // KeyFunction のとき F1=1, F2=2, ...
+	Mouse  MouseButton
+	MouseX int
+	MouseY int
+	Raw    []byte
+}
+
+// decodeKey は tty から1回の Read で読み取った生バイト列を Key にデコード
+// する。矢印キーやファンクションキー、X10/SGR マウスレポートの ESC
+// シーケンスを認識し、それ以外は先頭1ルーンを KeyRune として返す。
+func decodeKey(b []byte) Key {
+	if len(b) == 0 {
+		return Key{Type: KeyUnknown, Raw: b}
+	}
+
+	switch b[0] {
+	case 3:
+		return Key{Type: KeyCtrlC, Raw: b}
+	case 4:
+		return Key{Type: KeyCtrlD, Raw: b}
+	case 9:
+		return Key{Type: KeyTab, Raw: b}
+	case 13, 10:
+		return Key{Type: KeyEnter, Rune: rune(b[0]), Raw: b}
+	case 127, 8:
+		return Key{Type: KeyBackspace, Raw: b}
+	case 27:
+		if k, ok := decodeEscape(b); ok {
+			return k
+		}
+		return Key{Type: KeyEscape, Raw: b}
+	}
+
+	r, _ := utf8.DecodeRune(b)
+	return Key{Type: KeyRune, Rune: r, Raw: b}
+}
+
+// decodeEscape は ESC から始まるシーケンス (矢印・ファンクションキー・
+// マウスレポート) のデコードを試みる。
+func decodeEscape(b []byte) (Key, bool) {
+	if len(b) < 3 || b[1] != '[' {
+		return Key{}, false
+	}
+	switch b[2] {
+	case 'A':
+		return Key{Type: KeyUp, Raw: b}, true
+	case 'B':
+		return Key{Type: KeyDown, Raw: b}, true
+	case 'C':
+		return Key{Type: KeyRight, Raw: b}, true
+	case 'D':
+		return Key{Type: KeyLeft, Raw: b}, true
+	case 'M':
+		// X10 マウスレポート: ESC [ M <btn+32> <x+32> <y+32>
+		if len(b) < 6 {
+			return Key{}, false
+		}
+		return decodeX10Mouse(b), true
+	case '<':
+		// SGR マウスレポート: ESC [ < Pb ; Px ; Py M/m
+		return decodeSGRMouse(b)
+	}
+	if b[2] >= '0' && b[2] <= '9' {
+		return decodeFunctionKey(b)
+	}
+	return Key{}, false
+}
+
+func decodeX10Mouse(b []byte) Key {
+	btn := int(b[3]) - 32
+	x := int(b[4]) - 32
+	y := int(b[5]) - 32
+	return Key{Type: KeyMouse, Mouse: MouseButton(btn & 0x3), MouseX: x, MouseY: y, Raw: b}
+}
+
+func decodeSGRMouse(b []byte) (Key, bool) {
+	s := string(b[3:])
+	end := strings.IndexAny(s, "Mm")
+	if end < 0 {
+		return Key{}, false
+	}
+	released := s[end] == 'm'
+	parts := strings.Split(s[:end], ";")
+	if len(parts) != 3 {
+		return Key{}, false
+	}
+	btn, err1 := strconv.Atoi(parts[0])
+	x, err2 := strconv.Atoi(parts[1])
+	y, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return Key{}, false
+	}
+	mb := MouseButton(btn & 0x3)
+	if released {
+		mb = MouseRelease
+	}
+	return Key{Type: KeyMouse, Mouse: mb, MouseX: x, MouseY: y, Raw: b}, true
+}
+
+// decodeFunctionKey は "ESC [ <n> ~" 形式のファンクションキーをデコードする
+// (例: F5 = ESC [ 15 ~)。
+func decodeFunctionKey(b []byte) (Key, bool) {
+	end := -1
+	for i := 2; i < len(b); i++ {
+		if b[i] == '~' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return Key{}, false
+	}
+	n, err := strconv.Atoi(string(b[2:end]))
+	if err != nil {
+		return Key{}, false
+	}
+	return Key{Type: KeyFunction, FnNum: fnNumberFor(n), Raw: b}, true
+}
+
+// fnNumberFor は CSI ~ コードを F1, F2... の番号に変換する
+// (端末によって差異があるため代表的な割当のみ対応)。
+func fnNumberFor(code int) int {
+	switch code {
+	case 11, 12, 13, 14, 15:
+		return code - 10
+	case 17, 18, 19, 20, 21:
+		return code - 11
+	case 23, 24:
+		return code - 12
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,20 @@
+package tui
+
+import "io"
+
+// Model は Program が駆動する画面の実装が満たすインターフェース。
+// bubbletea の Model/Update/View にならった最小限の契約。
+type Model interface {
+	// Init は起動直後に描画する最初の画面を返す。
+	Init() string
+	// Update は1回分の入力イベントを処理し、以後の Model (差し替えは
+	// 任意、多くは自分自身) と継続するかどうかを返す。false を返すと
+	// Program はループを抜ける。
+	Update(key Key) (Model, bool)
+	// View は現在の状態の描画内容を返す。
+	View() string
+	// SetOutput は Program が管理する出力先を model に伝える。アニメー
+	// ションなど Update の最中に自分で描画したい Model は、ここで受け
+	// 取ったライターに書き込む。
+	SetOutput(w io.Writer)
+}
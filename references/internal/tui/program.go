@@ -0,0 +1,124 @@
+// Package tui は lightsout の main が抱えていたターミナル制御 (raw モード
+// の設定・復元、生バイトの入力ループ、ANSI 出力) を、bubbletea に着想を
+// 得た Program/Model/Update/View という小さな枠組みに切り出したもの。
+// Program が raw モードの生涯と入力デコード・描画を受け持ち、個々の画面は
+// Model を実装するだけでよくなる。
+package tui
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"lightsout/internal/termout"
+)
+
+const (
+	ansiHide  = "\033[?25l"
+	ansiShow  = "\033[?25h"
+	ansiClear = "\033[2J\033[H"
+	ansiReset = "\033[0m"
+)
+
+// Program は1つの Model を raw モードの端末上で駆動する。
+type Program struct {
+	model Model
+}
+
+// NewProgram は m を駆動する Program を返す。
+func NewProgram(m Model) *Program {
+	return &Program{model: m}
+}
+
+// Run は tty の入力側を raw モードで開き、Init → (入力デコード → Update →
+// View)* のループを Ctrl-C/Ctrl-D や Update が false を返すまで回す。
+// 描画は os.Stdout ではなく tty の出力側に直接書き込むため、stdout は
+// リダイレクトしても ANSI 制御シーケンスやゲーム画面で汚れない。
+// 終了時は raw モードとカーソル表示を必ず元に戻す。
+func (p *Program) Run() error {
+	in, out, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if out != in {
+		defer out.Close()
+	}
+
+	fd := int(in.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("raw モード設定に失敗しました: %w", err)
+	}
+	w := termout.Wrap(out)
+	defer func() {
+		_ = term.Restore(fd, oldState)
+		fmt.Fprint(w, ansiShow+ansiReset+"\r\n")
+	}()
+
+	rend := newRenderer(w)
+	p.model.SetOutput(rend)
+
+	fmt.Fprint(w, ansiHide)
+	fmt.Fprint(rend, p.model.Init())
+
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			break
+		}
+		model, ok := p.model.Update(decodeKey(buf[:n]))
+		p.model = model
+		if !ok {
+			break
+		}
+		fmt.Fprint(rend, p.model.View())
+	}
+
+	fmt.Fprint(w, ansiClear+ansiShow)
+	return nil
+}
+
+// Println は /dev/tty に直接1行書き込む。Run が戻った後、ゲーム固有の
+// 別れの挨拶のようにリダイレクトされた stdout を汚したくない出力を
+// 行いたい呼び出し元向けの小さなヘルパー。
+func Println(s string) error {
+	_, out, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(termout.Wrap(out), s); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// openTerminal は対話的な端末の入力側・出力側のハンドルを返す。POSIX では
+// /dev/tty は読み書き両対応なので両者は同じ *os.File になる。/dev/tty が
+// 開けない環境 (標準入出力のいずれかがリダイレクトされたコンテナ等) では
+// /proc/self/fd/0..2 のうち端末であるものを順に試す。出力側は呼び出し元で
+// termout.Wrap に通し、VT 処理のないレガシーな Windows コンソールでも
+// CSI シーケンスが正しく解釈されるようにする。
+func openTerminal() (in, out *os.File, err error) {
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		return tty, tty, nil
+	}
+	for n := 0; n <= 2; n++ {
+		path := fmt.Sprintf("/proc/self/fd/%d", n)
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			continue
+		}
+		if term.IsTerminal(int(f.Fd())) {
+			return f, f, nil
+		}
+		_ = f.Close()
+	}
+	return nil, nil, fmt.Errorf(
+		"インタラクティブなターミナルが見つかりません\n" +
+			"  ターミナルで直接 ./lightsout を実行してください",
+	)
+}
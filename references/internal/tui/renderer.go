@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+)
+
+// renderer は直前に書き込んだフレームと完全一致する内容の再書き込みを
+// 省略する diff-batch ライター。Program が Init/View の出力を流し込むのに
+// 使うほか、Model が Update の最中に自分で中間フレーム (アニメーション等)
+// を描画する場合もこれを共有することで、同じ最終フレームの二重出力を防ぐ。
+type renderer struct {
+	w    io.Writer
+	last []byte
+}
+
+func newRenderer(w io.Writer) *renderer {
+	return &renderer{w: w}
+}
+
+func (r *renderer) Write(p []byte) (int, error) {
+	if bytes.Equal(p, r.last) {
+		return len(p), nil
+	}
+	r.last = append(r.last[:0], p...)
+	if _, err := r.w.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
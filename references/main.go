@@ -1,14 +1,20 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/term"
+	"lightsout/internal/audio"
+	"lightsout/internal/tui"
 )
 
 // ── ANSI ──────────────────────────────────────────────────────
@@ -25,6 +31,7 @@ const (
 	ansiGray     = "\033[90m"
 	ansiYellowBG = "\033[43;30m"
 	ansiReverse  = "\033[7m"
+	ansiHintBG   = "\033[42;30m" // 緑背景・黒文字 (H キーのヒント表示)
 
 	// 解析モード外周セルの背景色
 	outerUnlit = "\033[44;37m" // 青背景・白文字 (消灯)
@@ -118,38 +125,160 @@ const (
 	StepRows MenuStep = iota
 	StepCols
 	StepMode
+	StepStamp
 )
 
+// ── トグルスタンプ ─────────────────────────────────────────────
+//
+// doToggle がどのセルを反転させるかを (dr,dc) オフセットの集合として表す。
+// GF4Compatible は、外周を GF(4) 行/列和ゼロに充填する fillOuterToZeroGF4 の
+// 数理（gf4Pow(r+c) による重み付けが doToggle のスタンプと両立する）が
+// 成立するスタンプかどうかを示す。キング（3×3、従来の挙動）以外では
+// 成立しないため false とし、解析モードの GF(4) オーバーレイを無効化する。
+type ToggleStamp struct {
+	Name          string
+	Offsets       []rc
+	GF4Compatible bool
+}
+
+func stampOffsets(coords [][2]int) []rc {
+	offs := make([]rc, len(coords))
+	for i, p := range coords {
+		offs[i] = rc{p[0], p[1]}
+	}
+	return offs
+}
+
+var (
+	stampKing = ToggleStamp{
+		Name:          "キング (3×3, 従来の挙動)",
+		Offsets:       stampOffsets([][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 0}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}),
+		GF4Compatible: true,
+	}
+	stampPlus = ToggleStamp{
+		Name:    "十字 (フォン・ノイマン近傍)",
+		Offsets: stampOffsets([][2]int{{0, 0}, {-1, 0}, {1, 0}, {0, -1}, {0, 1}}),
+	}
+	stampKnight = ToggleStamp{
+		Name: "ナイト (チェスのナイト移動)",
+		Offsets: stampOffsets([][2]int{
+			{0, 0},
+			{-2, -1}, {-2, 1}, {2, -1}, {2, 1},
+			{-1, -2}, {-1, 2}, {1, -2}, {1, 2},
+		}),
+	}
+	stampX = ToggleStamp{
+		Name:    "X字 (対角のみ)",
+		Offsets: stampOffsets([][2]int{{0, 0}, {-1, -1}, {-1, 1}, {1, -1}, {1, 1}}),
+	}
+)
+
+// builtinStamps は menuKey の StepStamp で選択肢として表示する順序。
+var builtinStamps = []ToggleStamp{stampKing, stampPlus, stampKnight, stampX}
+
+// loadStampFile は --stamp=file.json で渡されたファイルを読み込み、
+// ユーザ定義のオフセット集合から ToggleStamp を構築する。
+// ファイルは [{"dr":0,"dc":0}, ...] 形式の JSON 配列。
+func loadStampFile(path string) (ToggleStamp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ToggleStamp{}, err
+	}
+	var raw []struct {
+		Dr int `json:"dr"`
+		Dc int `json:"dc"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ToggleStamp{}, err
+	}
+	if len(raw) == 0 {
+		return ToggleStamp{}, fmt.Errorf("スタンプのオフセットが空です")
+	}
+	offs := make([]rc, len(raw))
+	for i, o := range raw {
+		offs[i] = rc{o.Dr, o.Dc}
+	}
+	return ToggleStamp{Name: "カスタム (" + filepath.Base(path) + ")", Offsets: offs}, nil
+}
+
 // ── ゲーム状態 ─────────────────────────────────────────────────
 
 type Game struct {
-	mode     Mode
-	rows     int // 盤の実際の行数 (解析モードでは mRows+1)
-	cols     int // 盤の実際の列数 (解析モードでは mCols+1)
-	board    [][]bool
-	curRow   int
-	curCol   int
-	history  [][][]bool
-	moves    int
+	mode         Mode
+	rows         int // 盤の実際の行数 (解析モードでは mRows+1)
+	cols         int // 盤の実際の列数 (解析モードでは mCols+1)
+	board        [][]bool
+	curRow       int
+	curCol       int
+	history      []undoEntry // U で遡れる操作履歴 (環状バッファ、最大 historyCap 件)
+	redoStack    []undoEntry // undo した操作を Y で再適用するためのスタック
+	historyCap   int
+	moves        int
 	analysis     bool
 	showAnalysis bool // GF(4) オーバーレイ表示フラグ (ゲームモード中に隠しコマンドで切替)
 	singleToggle bool // 解析モード: true=1マス反転, false=3×3反転
 	fromGame     bool // 解析モードへゲームモードから遷移した場合 true
 
 	// メニュー状態 (ユーザが入力した m, n を保持)
-	mStep  MenuStep
-	mRows  string // ユーザ入力 m (行数)
-	mCols  string // ユーザ入力 n (列数)
-	errMsg string
+	mStep            MenuStep
+	mRows            string // ユーザ入力 m (行数)
+	mCols            string // ユーザ入力 n (列数)
+	mPendingAnalysis bool   // StepMode で選んだモード (StepStamp 確定まで保持)
+	errMsg           string
+
+	stamp       ToggleStamp  // 現在の反転ルール (既定はキング = 従来の8近傍)
+	customStamp *ToggleStamp // --stamp=file.json で読み込んだカスタムスタンプ (nil なら無し)
+	stampMsg    string       // GF(4) 無効化などスタンプ起因のメッセージ
+
+	hint    *rc    // H キーで表示中のヒント座標 (次に押すべきボタン)
+	hintMsg string // ヒント/自動再生が出せなかった場合の理由
+
+	saveMsg string // S/L/C キー操作の結果メッセージ (成功/失敗/パズルコード)
+
+	daily      bool      // true なら D で開始した本日のチャレンジ
+	dailyDate  string    // daily=true のときの対象日 (YYYY-MM-DD)
+	dailyStart time.Time // daily の開始時刻 (CLEAR 時の経過時間計算に使う)
+	dailyDone  bool      // 結果を記録済みかどうか (再描画での二重記録を防ぐ)
+	dailyMsg   string    // CLEAR 画面に出すベスト記録・連続日数メッセージ
 
 	rng *rand.Rand
+
+	out io.Writer // 描画の書き込み先。既定は標準出力、SSH セッションでは対応するチャンネル
+
+	theme  Theme             // セルの配色 (config.json の theme)
+	keymap map[string]string // キー名 → "up"/"down"/"left"/"right"/"toggle" (config.json の keys)
+}
+
+// print は g.out に書き込む。ローカル実行では標準出力、serve サブコマンド
+// 経由の SSH セッションでは接続ごとのチャンネルに描画される。
+func (g *Game) print(s string) {
+	fmt.Fprint(g.out, s)
 }
 
 func newGame() *Game {
-	return &Game{
-		mode: ModeMenu,
-		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	cfg, err := loadConfig()
+	if err != nil {
+		cfg = defaultConfig()
+	}
+	g := &Game{
+		mode:       ModeMenu,
+		stamp:      stampKing,
+		historyCap: historyCapDefault,
+		out:        os.Stdout,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		theme:      cfg.Theme,
+		keymap:     cfg.keymap(),
+	}
+	if cfg.DefaultRows > 0 {
+		g.mRows = strconv.Itoa(cfg.DefaultRows)
 	}
+	if cfg.DefaultCols > 0 {
+		g.mCols = strconv.Itoa(cfg.DefaultCols)
+	}
+	if cfg.HistoryCap > 0 {
+		g.historyCap = cfg.HistoryCap
+	}
+	return g
 }
 
 func (g *Game) allocBoard(rows, cols int) {
@@ -185,17 +314,22 @@ func (g *Game) innerBounds() (rMin, rMax, cMin, cMax int) {
 }
 
 // scrambleSolvable は全セルにランダム合法手を適用して必ず解けるパズルを生成する。
-func (g *Game) scrambleSolvable() {
+// rng は g.rng を渡すのが通常だが、デイリーチャレンジのように日付から
+// 導いた乱数列で決定的に盤面を再現したい場合は別の *rand.Rand を渡せる。
+func (g *Game) scrambleSolvable(rng *rand.Rand) {
 	g.clearBoard()
 	for i := 0; i < g.rows*g.cols*3; i++ {
-		g.doToggle(g.rng.Intn(g.rows), g.rng.Intn(g.cols))
+		g.doToggle(rng.Intn(g.rows), rng.Intn(g.cols))
 	}
 	if g.isSolved() {
 		g.board[g.rows/2][g.cols/2] = true
 	}
 	g.history = nil
+	g.redoStack = nil
 	g.moves = 0
 	g.curRow, g.curCol = 0, 0
+	g.hint = nil
+	g.hintMsg = ""
 }
 
 // scrambleSolvableInner は解析モード専用。
@@ -218,6 +352,7 @@ func (g *Game) scrambleSolvableInner() {
 		g.board[(rMin+rMax)/2][(cMin+cMax)/2] = true
 	}
 	g.history = nil
+	g.redoStack = nil
 	g.moves = 0
 	if g.analysis {
 		g.curRow, g.curCol = 1, 1
@@ -237,6 +372,7 @@ func (g *Game) scrambleArbitrary() {
 		g.board[0][0] = true
 	}
 	g.history = nil
+	g.redoStack = nil
 	g.moves = 0
 	if g.analysis {
 		rMin, _, cMin, _ := g.innerBounds()
@@ -245,30 +381,103 @@ func (g *Game) scrambleArbitrary() {
 	}
 }
 
+// toggleBoard は stamp (single なら押した1マスのみ) を board 上の (row,col) に
+// 適用する。doToggle/doSingleToggle と undo/redo の再生、そして保存データ復元の
+// すべてがこのひとつの反転処理を共有する。
+func toggleBoard(board [][]bool, stamp ToggleStamp, row, col int, single bool) {
+	if single {
+		board[row][col] = !board[row][col]
+		return
+	}
+	rows, cols := len(board), len(board[0])
+	for _, off := range stamp.Offsets {
+		r, c := row+off.r, col+off.c
+		if r >= 0 && r < rows && c >= 0 && c < cols {
+			board[r][c] = !board[r][c]
+		}
+	}
+}
+
 // doSingleToggle は (row,col) のみを反転する（1マス反転）。
 func (g *Game) doSingleToggle(row, col int) {
-	g.board[row][col] = !g.board[row][col]
+	toggleBoard(g.board, ToggleStamp{}, row, col, true)
 }
 
-// doToggle は (row,col) と8近傍（盤面内のみ）を反転する。
+// doToggle は (row,col) に現在のトグルスタンプ (既定はキング = 8近傍) を
+// 適用し、盤面内のセルを反転する。
 func (g *Game) doToggle(row, col int) {
-	for dr := -1; dr <= 1; dr++ {
-		for dc := -1; dc <= 1; dc++ {
-			r, c := row+dr, col+dc
-			if r >= 0 && r < g.rows && c >= 0 && c < g.cols {
-				g.board[r][c] = !g.board[r][c]
+	toggleBoard(g.board, g.stamp, row, col, false)
+}
+
+// ── アンドゥ/リドゥ ────────────────────────────────────────────
+//
+// history は直近の操作を環状バッファ（最大 historyCap 件、超過分は最古から破棄）
+// で記録する。盤面が小さいうちは packed bitboard（1セル1ビット）のスナップショットを
+// 保持し、セル数が deltaHistoryThreshold を超える盤面では押したボタン位置だけを持つ
+// 差分記録に切り替えてメモリを節約する — doToggle/doSingleToggle はどちらも自己逆元
+// （同じ操作をもう一度適用すれば元に戻る）なので、差分だけで undo/redo を再現できる。
+// redo はこの自己逆元性を使い、モードによらず同じ操作を再適用するだけで済む。
+
+const historyCapDefault = 256
+const deltaHistoryThreshold = 64 // この値を超えるセル数の盤面では差分記録を使う
+
+// undoEntry は履歴1件分。delta なら row/col/stamp/single だけで再現し、
+// そうでなければ snap に操作前の盤面スナップショットを持つ。
+type undoEntry struct {
+	delta  bool
+	snap   []uint64
+	row    int
+	col    int
+	stamp  ToggleStamp
+	single bool
+}
+
+// packBoard は [][]bool の盤面を 1 セル 1 ビットの []uint64 に詰める。
+func packBoard(board [][]bool, rows, cols int) []uint64 {
+	n := rows * cols
+	bits := make([]uint64, (n+63)/64)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if board[r][c] {
+				i := cellIndex(r, c, cols)
+				bits[i/64] |= 1 << uint(i%64)
 			}
 		}
 	}
+	return bits
 }
 
-func (g *Game) pushHistory() {
-	snap := make([][]bool, g.rows)
-	for i, row := range g.board {
-		snap[i] = make([]bool, g.cols)
-		copy(snap[i], row)
+// unpackBoard は packBoard の逆変換で rows×cols の盤面を作る。
+func unpackBoard(bits []uint64, rows, cols int) [][]bool {
+	board := make([][]bool, rows)
+	for r := 0; r < rows; r++ {
+		board[r] = make([]bool, cols)
+		for c := 0; c < cols; c++ {
+			i := cellIndex(r, c, cols)
+			board[r][c] = bits[i/64]&(1<<uint(i%64)) != 0
+		}
 	}
-	g.history = append(g.history, snap)
+	return board
+}
+
+// pushHistory は (row,col) への反転操作を履歴に積む。single は1マス反転かどうか。
+// 新しい操作が積まれるたびに redo スタックは破棄する。
+func (g *Game) pushHistory(row, col int, single bool) {
+	e := undoEntry{row: row, col: col, stamp: g.stamp, single: single}
+	if g.rows*g.cols > deltaHistoryThreshold {
+		e.delta = true
+	} else {
+		e.snap = packBoard(g.board, g.rows, g.cols)
+	}
+	g.history = append(g.history, e)
+	limit := g.historyCap
+	if limit <= 0 {
+		limit = historyCapDefault
+	}
+	if len(g.history) > limit {
+		g.history = g.history[len(g.history)-limit:]
+	}
+	g.redoStack = nil
 }
 
 func (g *Game) undo() {
@@ -276,16 +485,33 @@ func (g *Game) undo() {
 	if n == 0 {
 		return
 	}
-	snap := g.history[n-1]
+	e := g.history[n-1]
 	g.history = g.history[:n-1]
-	for i := range g.board {
-		copy(g.board[i], snap[i])
+	if e.delta {
+		toggleBoard(g.board, e.stamp, e.row, e.col, e.single)
+	} else {
+		g.board = unpackBoard(e.snap, g.rows, g.cols)
 	}
+	g.redoStack = append(g.redoStack, e)
 	if g.moves > 0 {
 		g.moves--
 	}
 }
 
+// redo は直前に undo した操作を再適用する。doToggle/doSingleToggle の
+// 自己逆元性により、記録方式(delta/snapshot)によらず同じ反転をやり直すだけでよい。
+func (g *Game) redo() {
+	n := len(g.redoStack)
+	if n == 0 {
+		return
+	}
+	e := g.redoStack[n-1]
+	g.redoStack = g.redoStack[:n-1]
+	toggleBoard(g.board, e.stamp, e.row, e.col, e.single)
+	g.history = append(g.history, e)
+	g.moves++
+}
+
 func (g *Game) isSolved() bool {
 	for _, row := range g.board {
 		for _, v := range row {
@@ -370,22 +596,25 @@ func (g *Game) cellStr(row, col int) string {
 		return outerUnlit + sym + ansiReset
 	}
 
-	// 内部セル
+	if g.hint != nil && row == g.hint.r && col == g.hint.c {
+		return ansiHintBG + sym + ansiReset
+	}
+
+	// 内部セル (配色は config.json の theme で変更できる)
 	switch {
 	case cur && lit:
-		return ansiYellowBG + sym + ansiReset
+		return g.theme.Cursor + sym + ansiReset
 	case cur && !lit:
 		return ansiReverse + sym + ansiReset
 	case lit:
-		return ansiYellow + sym + ansiReset
+		return g.theme.OnCell + sym + ansiReset
 	default:
-		return ansiGray + sym + ansiReset
+		return g.theme.OffCell + sym + ansiReset
 	}
 }
 
 // ── メニュー描画 ───────────────────────────────────────────────
 
-
 // ── 解析モード遷移（ゲーム→解析） ─────────────────────────────
 
 type rc struct{ r, c int }
@@ -413,10 +642,16 @@ func (g *Game) enterAnalysisFromGame() {
 		}
 	}
 
-	// 外周を GF(4) 行/列和が全て 0 になるように埋める
-	g.fillOuterToZeroGF4()
+	// 外周を GF(4) 行/列和が全て 0 になるように埋める（対応スタンプのみ）
+	g.stampMsg = ""
+	if g.stamp.GF4Compatible {
+		g.fillOuterToZeroGF4()
+	} else {
+		g.stampMsg = "このスタンプでは GF(4) 不変量が成立しないため、外周ゼロ化と GF(4) オーバーレイを無効化しました"
+	}
 
 	g.history = nil
+	g.redoStack = nil
 	g.moves = 0
 	g.curRow, g.curCol = 1, 1
 }
@@ -442,6 +677,7 @@ func (g *Game) returnToGameFromAnalysis() {
 	}
 
 	g.history = nil
+	g.redoStack = nil
 	g.moves = 0
 	g.curRow, g.curCol = 0, 0
 }
@@ -569,6 +805,14 @@ func buildGF4ZeroSystem(rows, cols int, vars []rc, idx map[rc]int, internalRow,
 // solveGF2 は GF(2) の連立一次方程式をガウス消去で解く。
 // 解が存在すれば x を返し、存在しなければ ok=false。
 func solveGF2(eqs []gf2Eq, nVars int) (x []bool, ok bool) {
+	x, _, ok = solveGF2Ext(eqs, nVars)
+	return x, ok
+}
+
+// solveGF2Ext は solveGF2 と同じ解に加え、ピボット列の一覧を返す。
+// ピボット列でない列（自由変数）が分かれば、核（kernel）の基底を
+// kernelBasis で求めて非自明な解の自由度を探索できる。
+func solveGF2Ext(eqs []gf2Eq, nVars int) (x []bool, pivCols []int, ok bool) {
 	words := (nVars + 63) / 64
 	A := make([]gf2Eq, len(eqs))
 	for i := range eqs {
@@ -587,7 +831,7 @@ func solveGF2(eqs []gf2Eq, nVars int) (x []bool, ok bool) {
 	}
 
 	pivRow := 0
-	pivCols := make([]int, 0, minInt(len(A), nVars))
+	pivCols = make([]int, 0, minInt(len(A), nVars))
 
 	for col := 0; col < nVars && pivRow < len(A); col++ {
 		// pivot 探索
@@ -628,7 +872,7 @@ func solveGF2(eqs []gf2Eq, nVars int) (x []bool, ok bool) {
 			}
 		}
 		if all0 && A[r].rhs == 1 {
-			return nil, false
+			return nil, nil, false
 		}
 	}
 
@@ -667,7 +911,7 @@ func solveGF2(eqs []gf2Eq, nVars int) (x []bool, ok bool) {
 		}
 	}
 
-	return x, true
+	return x, pivCols, true
 }
 
 func minInt(a, b int) int {
@@ -677,6 +921,74 @@ func minInt(a, b int) int {
 	return b
 }
 
+// gf2SetBit は bs の i ビット目を立てる。buildGF4ZeroSystem 内の setBit と
+// 同じ操作だが、buildToggleSystem と kernelBasis からも使うため関数化した。
+func gf2SetBit(bs []uint64, i int) {
+	bs[i>>6] |= 1 << (uint(i) & 63)
+}
+
+// freeColumns は 0..nVars-1 のうち pivCols に含まれない列（自由変数）を返す。
+func freeColumns(pivCols []int, nVars int) []int {
+	isPiv := make([]bool, nVars)
+	for _, c := range pivCols {
+		isPiv[c] = true
+	}
+	var free []int
+	for c := 0; c < nVars; c++ {
+		if !isPiv[c] {
+			free = append(free, c)
+		}
+	}
+	return free
+}
+
+// kernelBasis は斉次方程式 (rhs をすべて 0 にしたもの) の核の基底を、
+// freeCols の各自由変数を 1 つだけ 1 に固定した解として求める。
+// solveGF2 をそのまま再利用し、固定用の方程式を追加するだけで済む。
+func kernelBasis(eqs []gf2Eq, nVars int, freeCols []int) [][]bool {
+	words := (nVars + 63) / 64
+	basis := make([][]bool, 0, len(freeCols))
+	for _, f := range freeCols {
+		aug := make([]gf2Eq, len(eqs), len(eqs)+len(freeCols))
+		for i, e := range eqs {
+			bs := make([]uint64, words)
+			copy(bs, e.bits)
+			aug[i] = gf2Eq{bits: bs, rhs: 0}
+		}
+		for _, f2 := range freeCols {
+			bs := make([]uint64, words)
+			gf2SetBit(bs, f2)
+			var rhs uint8
+			if f2 == f {
+				rhs = 1
+			}
+			aug = append(aug, gf2Eq{bits: bs, rhs: rhs})
+		}
+		if x, ok := solveGF2(aug, nVars); ok {
+			basis = append(basis, x)
+		}
+	}
+	return basis
+}
+
+// weight は GF(2) ベクトルのハミング重み（押すボタンの総数）を返す。
+func weight(x []bool) int {
+	n := 0
+	for _, v := range x {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// xorInto は dst に src を GF(2) 加算（XOR）で足し込む。
+func xorInto(dst, src []bool) {
+	for i := range dst {
+		dst[i] = dst[i] != src[i]
+	}
+}
+
 // bitsOnesParity は popcount(x) mod 2 を返す。
 func bitsOnesParity(x uint64) uint64 {
 	x ^= x >> 32
@@ -688,6 +1000,410 @@ func bitsOnesParity(x uint64) uint64 {
 	return x & 1
 }
 
+// ── ソルバー (最小手数) ────────────────────────────────────────
+//
+// 現在の盤面を Ax = b (GF(2)) と見なして解く。変数 x はボタン (r,c) を
+// 押したかどうか（押下回数の偶奇）、行列 A の各列は doToggle が反転させる
+// セルの集合（3×3 スタンプ）、b は現在の点灯状態。
+// 解が複数ある場合（カーネルが非自明）は、自由変数の組み合わせを
+// maxKernelDim 次元まで総当たりし、最小ハミング重み（= 最小手数）の解を選ぶ。
+
+const maxKernelDim = 20
+
+// cellIndex は (r,c) を行優先の通し番号に変換する。
+func cellIndex(r, c, cols int) int { return r*cols + c }
+
+// buildToggleSystem は doToggle の現在のトグルスタンプにもとづき、現在の盤面を
+// 解消する（全消灯にする）ための GF(2) 連立一次方程式を組み立てる。
+func (g *Game) buildToggleSystem() []gf2Eq {
+	n := g.rows * g.cols
+	words := (n + 63) / 64
+	eqs := make([]gf2Eq, n)
+	for r := 0; r < g.rows; r++ {
+		for c := 0; c < g.cols; c++ {
+			bs := make([]uint64, words)
+			for _, off := range g.stamp.Offsets {
+				rr, cc := r+off.r, c+off.c
+				if rr >= 0 && rr < g.rows && cc >= 0 && cc < g.cols {
+					gf2SetBit(bs, cellIndex(rr, cc, g.cols))
+				}
+			}
+			var rhs uint8
+			if g.board[r][c] {
+				rhs = 1
+			}
+			eqs[cellIndex(r, c, g.cols)] = gf2Eq{bits: bs, rhs: rhs}
+		}
+	}
+	return eqs
+}
+
+// solveResult は solve() が見つけた手順を表す。
+type solveResult struct {
+	presses []rc   // 押すべきボタン。最小手数になるよう並べた順序
+	ok      bool   // 解けるなら true
+	reason  string // ok=false のときに表示する理由
+}
+
+// solve は現在の盤面を全消灯にする最小手数の手順を求める。
+// GF(2) の連立一次方程式には複数解があり得るため、カーネルの次元が
+// maxKernelDim 以下なら全組み合わせを試して最小ハミング重みの解を選ぶ。
+// 次元がそれより大きい場合はガウス消去が返す最初の解をそのまま使う。
+func (g *Game) solve() solveResult {
+	eqs := g.buildToggleSystem()
+	nVars := g.rows * g.cols
+
+	x, pivCols, ok := solveGF2Ext(eqs, nVars)
+	if !ok {
+		return solveResult{reason: "この配置は現在のトグル規則では解けません"}
+	}
+
+	best := x
+	free := freeColumns(pivCols, nVars)
+	if len(free) > 0 && len(free) <= maxKernelDim {
+		basis := kernelBasis(eqs, nVars, free)
+		bestWeight := weight(best)
+		for mask := 1; mask < (1 << len(basis)); mask++ {
+			cand := make([]bool, nVars)
+			copy(cand, x)
+			for i, b := range basis {
+				if mask&(1<<i) != 0 {
+					xorInto(cand, b)
+				}
+			}
+			if w := weight(cand); w < bestWeight {
+				bestWeight = w
+				best = cand
+			}
+		}
+	}
+
+	var presses []rc
+	for r := 0; r < g.rows; r++ {
+		for c := 0; c < g.cols; c++ {
+			if best[cellIndex(r, c, g.cols)] {
+				presses = append(presses, rc{r, c})
+			}
+		}
+	}
+	return solveResult{presses: presses, ok: true}
+}
+
+// hintNext は solve() の手順の先頭（次に押すべきボタン）だけを返す。
+// ヒント表示 ("H" キー) から呼ばれる。
+func (g *Game) hintNext() (rc, bool, string) {
+	res := g.solve()
+	if !res.ok {
+		return rc{}, false, res.reason
+	}
+	if len(res.presses) == 0 {
+		return rc{}, false, ""
+	}
+	return res.presses[0], true, ""
+}
+
+// ── 保存/読み込み ──────────────────────────────────────────────
+
+// savedState は state.json に書き出すゲーム状態のスナップショット。
+type savedState struct {
+	Rows         int              `json:"rows"`
+	Cols         int              `json:"cols"`
+	Analysis     bool             `json:"analysis"`
+	SingleToggle bool             `json:"single_toggle"`
+	FromGame     bool             `json:"from_game"`
+	MRows        string           `json:"m_rows"`
+	MCols        string           `json:"m_cols"`
+	Board        [][]bool         `json:"board"`
+	Moves        int              `json:"moves"`
+	History      []savedUndoEntry `json:"history"`
+}
+
+// savedUndoEntry は undoEntry の JSON 化用シャドウ型。rc は非公開フィールドなので
+// Offsets は [dr,dc] のペア配列に変換して保存する。
+type savedUndoEntry struct {
+	Delta         bool     `json:"delta"`
+	Snap          []uint64 `json:"snap,omitempty"`
+	Row           int      `json:"row"`
+	Col           int      `json:"col"`
+	StampName     string   `json:"stamp_name"`
+	StampOffsets  [][2]int `json:"stamp_offsets"`
+	GF4Compatible bool     `json:"gf4_compatible"`
+	Single        bool     `json:"single"`
+}
+
+// toSavedEntries は g.history を JSON 保存できる形に変換する。
+func toSavedEntries(entries []undoEntry) []savedUndoEntry {
+	out := make([]savedUndoEntry, len(entries))
+	for i, e := range entries {
+		offs := make([][2]int, len(e.stamp.Offsets))
+		for j, o := range e.stamp.Offsets {
+			offs[j] = [2]int{o.r, o.c}
+		}
+		out[i] = savedUndoEntry{
+			Delta:         e.delta,
+			Snap:          e.snap,
+			Row:           e.row,
+			Col:           e.col,
+			StampName:     e.stamp.Name,
+			StampOffsets:  offs,
+			GF4Compatible: e.stamp.GF4Compatible,
+			Single:        e.single,
+		}
+	}
+	return out
+}
+
+// fromSavedEntries は toSavedEntries の逆変換で g.history を復元する。
+func fromSavedEntries(saved []savedUndoEntry) []undoEntry {
+	out := make([]undoEntry, len(saved))
+	for i, s := range saved {
+		offs := make([]rc, len(s.StampOffsets))
+		for j, o := range s.StampOffsets {
+			offs[j] = rc{o[0], o[1]}
+		}
+		out[i] = undoEntry{
+			delta: s.Delta,
+			snap:  s.Snap,
+			row:   s.Row,
+			col:   s.Col,
+			stamp: ToggleStamp{
+				Name:          s.StampName,
+				Offsets:       offs,
+				GF4Compatible: s.GF4Compatible,
+			},
+			single: s.Single,
+		}
+	}
+	return out
+}
+
+// stateFilePath は保存ファイルのパスを返す。
+// $XDG_STATE_HOME/lightsout/state.json、未設定時は ~/.local/state/lightsout/state.json。
+func stateFilePath() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "lightsout", "state.json"), nil
+}
+
+// saveState は現在のゲーム状態を state.json に書き出す ("S" キー)。
+func (g *Game) saveState() error {
+	path, err := stateFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	st := savedState{
+		Rows:         g.rows,
+		Cols:         g.cols,
+		Analysis:     g.analysis,
+		SingleToggle: g.singleToggle,
+		FromGame:     g.fromGame,
+		MRows:        g.mRows,
+		MCols:        g.mCols,
+		Board:        g.board,
+		Moves:        g.moves,
+		History:      toSavedEntries(g.history),
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadState は state.json からゲーム状態を復元する ("L" キー)。
+func (g *Game) loadState() error {
+	path, err := stateFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var st savedState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+
+	g.allocBoard(st.Rows, st.Cols)
+	for r := range st.Board {
+		copy(g.board[r], st.Board[r])
+	}
+	g.analysis = st.Analysis
+	g.singleToggle = st.SingleToggle
+	g.fromGame = st.FromGame
+	g.mRows = st.MRows
+	g.mCols = st.MCols
+	g.moves = st.Moves
+	g.history = fromSavedEntries(st.History)
+	g.redoStack = nil
+	g.mode = ModeGame
+	g.hint = nil
+	g.hintMsg = ""
+	g.curRow, g.curCol = 0, 0
+	return nil
+}
+
+// ── パズルコード ───────────────────────────────────────────────
+//
+// 行数・列数・解析モードフラグ・点灯状態の各ビットを詰めた
+// [rows][cols][flags][packed bits...] を base64 にした、貼り付けで
+// 共有できる短い文字列。
+
+// encodePuzzleCode は現在の盤面を共有可能な base64 文字列に変換する。
+// トグルスタンプが既定のキング以外の場合、doToggle の挙動が受け取り手側と
+// 食い違わないよう、点灯状態の後ろにスタンプ名とオフセット集合も詰める
+// (chunk0-3 でスタンプを設定可能にした際に追加)。
+func (g *Game) encodePuzzleCode() string {
+	n := g.rows * g.cols
+	packed := make([]byte, 3+(n+7)/8)
+	packed[0] = byte(g.rows)
+	packed[1] = byte(g.cols)
+	if g.analysis {
+		packed[2] = 1
+	}
+	for r := 0; r < g.rows; r++ {
+		for c := 0; c < g.cols; c++ {
+			if g.board[r][c] {
+				i := cellIndex(r, c, g.cols)
+				packed[3+i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+	packed = append(packed, encodeStamp(g.stamp)...)
+	return base64.RawURLEncoding.EncodeToString(packed)
+}
+
+// encodeStamp はトグルスタンプを「名前長 + 名前 + オフセット数 +
+// (dr,dc を符号付き1バイトずつ)」の形でシリアライズする。
+func encodeStamp(st ToggleStamp) []byte {
+	name := []byte(st.Name)
+	buf := make([]byte, 0, 2+len(name)+2*len(st.Offsets))
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	buf = append(buf, byte(len(st.Offsets)))
+	for _, off := range st.Offsets {
+		buf = append(buf, byte(int8(off.r)), byte(int8(off.c)))
+	}
+	return buf
+}
+
+// decodeStamp は encodeStamp の逆変換で、buf の先頭からスタンプ1つ分を
+// 読み取る。読み込んだ名前・オフセットが builtinStamps のいずれかと一致
+// すれば GF4Compatible 等の付随情報もそのスタンプから引き継ぎ、一致しな
+// ければ (--stamp=file.json で渡されたカスタムスタンプ相当として)
+// GF4Compatible=false の ToggleStamp を組み立てる。
+func decodeStamp(buf []byte) (ToggleStamp, error) {
+	if len(buf) < 1 {
+		return ToggleStamp{}, fmt.Errorf("パズルコードにスタンプ情報がありません")
+	}
+	nameLen := int(buf[0])
+	buf = buf[1:]
+	if len(buf) < nameLen+1 {
+		return ToggleStamp{}, fmt.Errorf("パズルコードのスタンプ名が壊れています")
+	}
+	name := string(buf[:nameLen])
+	buf = buf[nameLen:]
+	offCount := int(buf[0])
+	buf = buf[1:]
+	if len(buf) < 2*offCount {
+		return ToggleStamp{}, fmt.Errorf("パズルコードのオフセット数が壊れています")
+	}
+	offsets := make([]rc, offCount)
+	for i := 0; i < offCount; i++ {
+		offsets[i] = rc{r: int(int8(buf[2*i])), c: int(int8(buf[2*i+1]))}
+	}
+	for _, known := range builtinStamps {
+		if known.Name == name && toggleOffsetsEqual(known.Offsets, offsets) {
+			return known, nil
+		}
+	}
+	return ToggleStamp{Name: name, Offsets: offsets}, nil
+}
+
+func toggleOffsetsEqual(a, b []rc) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decodePuzzleCode は encodePuzzleCode で作られた文字列から盤面を復元する。
+func decodePuzzleCode(code string) (rows, cols int, board [][]bool, analysis bool, stamp ToggleStamp, err error) {
+	packed, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil {
+		return 0, 0, nil, false, ToggleStamp{}, err
+	}
+	if len(packed) < 3 {
+		return 0, 0, nil, false, ToggleStamp{}, fmt.Errorf("パズルコードが短すぎます")
+	}
+	rows, cols = int(packed[0]), int(packed[1])
+	analysis = packed[2]&1 == 1
+	n := rows * cols
+	boardBytes := (n + 7) / 8
+	if rows <= 0 || cols <= 0 || len(packed) < 3+boardBytes {
+		return 0, 0, nil, false, ToggleStamp{}, fmt.Errorf("パズルコードの長さが盤面サイズと一致しません")
+	}
+	board = make([][]bool, rows)
+	for r := range board {
+		board[r] = make([]bool, cols)
+		for c := range board[r] {
+			i := cellIndex(r, c, cols)
+			board[r][c] = packed[3+i/8]&(1<<uint(i%8)) != 0
+		}
+	}
+	stamp, err = decodeStamp(packed[3+boardBytes:])
+	if err != nil {
+		return 0, 0, nil, false, ToggleStamp{}, err
+	}
+	return rows, cols, board, analysis, stamp, nil
+}
+
+// loadPuzzleCode は --puzzle=CODE フラグから渡されたコードで盤面を初期化する。
+func (g *Game) loadPuzzleCode(code string) error {
+	rows, cols, board, analysis, stamp, err := decodePuzzleCode(code)
+	if err != nil {
+		return err
+	}
+	g.allocBoard(rows, cols)
+	g.board = board
+	g.analysis = analysis
+	g.stamp = stamp
+	g.mRows = strconv.Itoa(rows)
+	g.mCols = strconv.Itoa(cols)
+	g.mode = ModeGame
+	g.history = nil
+	g.redoStack = nil
+	g.moves = 0
+	g.curRow, g.curCol = 0, 0
+	return nil
+}
+
+// stampChoices はメニューの StepStamp で提示する選択肢を返す。
+// --stamp=file.json が読み込まれていれば末尾にカスタムスタンプを加える。
+func (g *Game) stampChoices() []ToggleStamp {
+	choices := make([]ToggleStamp, len(builtinStamps))
+	copy(choices, builtinStamps)
+	if g.customStamp != nil {
+		choices = append(choices, *g.customStamp)
+	}
+	return choices
+}
+
 func (g *Game) renderMenu() string {
 	var sb strings.Builder
 	sb.WriteString(ansiClear + "\r\n")
@@ -708,6 +1424,9 @@ func (g *Game) renderMenu() string {
 		sb.WriteString("  n (列数) > " + g.mCols + ansiBold + "█" + ansiReset + "\r\n")
 
 	case StepMode:
+		m, _ := strconv.Atoi(g.mRows)
+		n, _ := strconv.Atoi(g.mCols)
+
 		sb.WriteString(fmt.Sprintf("  盤面サイズ: m=%s, n=%s\r\n\r\n", g.mRows, g.mCols))
 		sb.WriteString("  モードを選択してください:\r\n\r\n")
 
@@ -715,8 +1434,6 @@ func (g *Game) renderMenu() string {
 		sb.WriteString(fmt.Sprintf("      盤面: %s 行 × %s 列\r\n", g.mRows, g.mCols))
 		sb.WriteString("      hjkl/↑↓←→ 移動  Space/Enter 反転  U アンドゥ  R リスタート\r\n\r\n")
 
-		m, _ := strconv.Atoi(g.mRows)
-		n, _ := strconv.Atoi(g.mCols)
 		sb.WriteString("  " + ansiBold + "[2]" + ansiReset + " 数理解析モード\r\n")
 		sb.WriteString(fmt.Sprintf("      盤面: %d 行 × %d 列  (外周1マス含む)\r\n", m+1, n+1))
 		sb.WriteString("      外周セル " + outerUnlit + " □ " + ansiReset +
@@ -728,7 +1445,23 @@ func (g *Game) renderMenu() string {
 		for _, v := range []GF4{G0, G1, GOm, GOm2} {
 			sb.WriteString(gf4Str(v) + " ")
 		}
-		sb.WriteString("\r\n")
+		sb.WriteString("\r\n\r\n")
+
+		sb.WriteString("  " + ansiBold + "[D]" + ansiReset + " 本日のチャレンジ (" + time.Now().Format("2006-01-02") + ")\r\n")
+		sb.WriteString(fmt.Sprintf("      %s 行 × %s 列  世界共通の盤面で手数・タイムを競う\r\n", g.mRows, g.mCols))
+		if streak := dailyStreakToday(m, n); streak > 0 {
+			sb.WriteString(fmt.Sprintf("      連続達成: %d 日\r\n", streak))
+		}
+
+	case StepStamp:
+		sb.WriteString("  トグルスタンプ（ボタンを押したときに反転する範囲）を選択してください:\r\n\r\n")
+		for i, st := range g.stampChoices() {
+			sb.WriteString(fmt.Sprintf("  %s[%d]%s %s", ansiBold, i+1, ansiReset, st.Name))
+			if g.mPendingAnalysis && !st.GF4Compatible {
+				sb.WriteString(ansiGray + "  (解析モードでは GF(4) オーバーレイを無効化)" + ansiReset)
+			}
+			sb.WriteString("\r\n")
+		}
 	}
 
 	if g.errMsg != "" {
@@ -741,10 +1474,16 @@ func (g *Game) renderMenu() string {
 		sb.WriteString("  [Enter] 次へ   [BS] 削除   [Q] 終了\r\n")
 	case StepMode:
 		sb.WriteString("  [1/2] 選択   [BS] 戻る   [Q] 終了\r\n")
+	case StepStamp:
+		sb.WriteString(fmt.Sprintf("  [1-%d] 選択   [BS] 戻る   [Q] 終了\r\n", len(g.stampChoices())))
 	}
 
+	ruleStamp := "周囲8マス (キング)"
+	if g.mStep == StepStamp {
+		ruleStamp = "選択中のスタンプ"
+	}
 	sb.WriteString("\r\n" + ansiBold + "  【ルール】" + ansiReset +
-		" パネルを押すとそのパネルと周囲8マスが反転。すべて消灯させればクリア！\r\n")
+		" パネルを押すとそのパネルと" + ruleStamp + "が反転。すべて消灯させればクリア！\r\n")
 
 	return sb.String()
 }
@@ -762,14 +1501,20 @@ func (g *Game) renderGame() string {
 		sb.WriteString(ansiBold + "  LIGHTS OUT [ANALYSIS]" + ansiReset)
 		m, _ := strconv.Atoi(g.mRows)
 		n, _ := strconv.Atoi(g.mCols)
-		sb.WriteString(fmt.Sprintf("   (%d+2)×(%d+2)=%d×%d  手数: %d",
-			m, n, g.rows, g.cols, g.moves))
+		sb.WriteString(fmt.Sprintf("   (%d+2)×(%d+2)=%d×%d  手数: %d  undo: %d  redo: %d",
+			m, n, g.rows, g.cols, g.moves, len(g.history), len(g.redoStack)))
 	} else if g.showAnalysis {
 		sb.WriteString(ansiBold + "  LIGHTS OUT" + ansiReset + ansiYellow + " [GF₄]" + ansiReset)
-		sb.WriteString(fmt.Sprintf("   %d×%d  手数: %d", g.rows, g.cols, g.moves))
+		sb.WriteString(fmt.Sprintf("   %d×%d  手数: %d  undo: %d  redo: %d", g.rows, g.cols, g.moves, len(g.history), len(g.redoStack)))
+	} else if g.daily {
+		sb.WriteString(ansiBold + "  LIGHTS OUT" + ansiReset + ansiYellow + " [DAILY " + g.dailyDate + "]" + ansiReset)
+		sb.WriteString(fmt.Sprintf("   %d×%d  手数: %d  undo: %d  redo: %d", g.rows, g.cols, g.moves, len(g.history), len(g.redoStack)))
 	} else {
 		sb.WriteString(ansiBold + "  LIGHTS OUT" + ansiReset)
-		sb.WriteString(fmt.Sprintf("   %d×%d  手数: %d", g.rows, g.cols, g.moves))
+		sb.WriteString(fmt.Sprintf("   %d×%d  手数: %d  undo: %d  redo: %d", g.rows, g.cols, g.moves, len(g.history), len(g.redoStack)))
+	}
+	if g.stamp.Name != stampKing.Name {
+		sb.WriteString("   " + ansiGray + g.stamp.Name + ansiReset)
 	}
 	if len(g.history) > 0 {
 		sb.WriteString("   " + ansiBold + "[U]" + ansiReset)
@@ -778,7 +1523,7 @@ func (g *Game) renderGame() string {
 
 	// 解析モードまたはオーバーレイ表示時は右に GF(4) 行和列を追加
 	drawCols := g.cols
-	if g.analysis || g.showAnalysis {
+	if (g.analysis || g.showAnalysis) && g.stamp.GF4Compatible {
 		drawCols++
 	}
 
@@ -795,7 +1540,7 @@ func (g *Game) renderGame() string {
 			sb.WriteString("│")
 		}
 		// GF(4) 重み付き行和
-		if g.analysis || g.showAnalysis {
+		if (g.analysis || g.showAnalysis) && g.stamp.GF4Compatible {
 			sb.WriteString(gf4Str(g.gf4RowSum(r)))
 			sb.WriteString("│")
 		}
@@ -803,7 +1548,7 @@ func (g *Game) renderGame() string {
 	}
 
 	// GF(4) 列和行
-	if g.analysis || g.showAnalysis {
+	if (g.analysis || g.showAnalysis) && g.stamp.GF4Compatible {
 		sb.WriteString("  " + borderLine("├", "┼", "┤", "───", drawCols))
 		sb.WriteString("  │")
 		for c := 0; c < g.cols; c++ {
@@ -836,16 +1581,20 @@ func (g *Game) renderGame() string {
 		sb.WriteString("  " + outerUnlit + " □ " + ansiReset + " 外周   " +
 			ansiGray + " □ " + ansiReset + " 内部消灯   " +
 			ansiYellow + " ■ " + ansiReset + " 内部点灯\r\n")
-		sb.WriteString("  F₄: ")
-		for _, v := range []GF4{G0, G1, GOm, GOm2} {
-			sb.WriteString(gf4Str(v) + " ")
+		if g.stamp.GF4Compatible {
+			sb.WriteString("  F₄: ")
+			for _, v := range []GF4{G0, G1, GOm, GOm2} {
+				sb.WriteString(gf4Str(v) + " ")
+			}
+			sb.WriteString("\r\n")
+		} else if g.stampMsg != "" {
+			sb.WriteString("\r\n  " + ansiRed + "! " + g.stampMsg + ansiReset + "\r\n")
 		}
-		sb.WriteString("\r\n")
 		if solved {
 			sb.WriteString("\r\n" + ansiBold + ansiGreen + "  ★ すべて消灯！ ★" + ansiReset + "\r\n")
 		}
 	} else if g.showAnalysis {
-		sb.WriteString("  hjkl / ↑↓←→ 移動   Space/Enter 反転   U アンドゥ   R リスタート   Q メニュー\r\n")
+		sb.WriteString("  hjkl / ↑↓←→ 移動   Space/Enter 反転   U アンドゥ   Y リドゥ   R リスタート   Q メニュー\r\n")
 		sb.WriteString("  " + ansiBold + "[\\]" + ansiReset + " GF₄ 表示オン/オフ\r\n")
 		sb.WriteString("\r\n  F₄: ")
 		for _, v := range []GF4{G0, G1, GOm, GOm2} {
@@ -860,11 +1609,29 @@ func (g *Game) renderGame() string {
 	} else if solved {
 		sb.WriteString(ansiBold + ansiGreen +
 			"  ★ CLEAR！すべて消灯！手数: " + strconv.Itoa(g.moves) + " ★\r\n" + ansiReset)
+		if g.daily && g.dailyMsg != "" {
+			sb.WriteString("  " + ansiYellow + "[デイリー " + g.dailyDate + "] " + g.dailyMsg + ansiReset + "\r\n")
+		}
 		sb.WriteString("\r\n  [R] もう一度   [Q] メニューへ\r\n")
 	} else {
-		sb.WriteString("  hjkl / ↑↓←→ 移動   Space/Enter 反転   U アンドゥ   R リスタート   Q メニュー\r\n")
+		sb.WriteString("  hjkl / ↑↓←→ 移動   Space/Enter 反転   U アンドゥ   Y リドゥ   R リスタート   Q メニュー\r\n")
+		sb.WriteString("  " + ansiBold + "H" + ansiReset + " ヒント表示   " +
+			ansiBold + "P" + ansiReset + " 自動解答\r\n")
+		sb.WriteString("  " + ansiBold + "S" + ansiReset + " 保存   " +
+			ansiBold + "L" + ansiReset + " 読み込み   " +
+			ansiBold + "C" + ansiReset + " パズルコード表示\r\n")
 		sb.WriteString("\r\n  " + ansiYellow + "■" + ansiReset + " 点灯   " +
-			ansiGray + "□" + ansiReset + " 消灯\r\n")
+			ansiGray + "□" + ansiReset + " 消灯   " +
+			ansiHintBG + " ■ " + ansiReset + " ヒント\r\n")
+		if g.hintMsg != "" {
+			sb.WriteString("\r\n  " + ansiRed + "! " + g.hintMsg + ansiReset + "\r\n")
+		}
+		if g.saveMsg != "" {
+			sb.WriteString("\r\n  " + ansiGreen + g.saveMsg + ansiReset + "\r\n")
+		}
+		if g.stampMsg != "" {
+			sb.WriteString("\r\n  " + ansiRed + "! " + g.stampMsg + ansiReset + "\r\n")
+		}
 	}
 
 	return sb.String()
@@ -890,7 +1657,7 @@ func (g *Game) handleKey(b []byte) bool {
 
 func (g *Game) menuKey(b []byte) bool {
 	if len(b) != 1 {
-		fmt.Print(g.renderMenu())
+		g.print(g.renderMenu())
 		return true
 	}
 	ch := b[0]
@@ -947,18 +1714,35 @@ func (g *Game) menuKey(b []byte) bool {
 	case StepMode:
 		switch ch {
 		case '1':
-			g.startGame(false)
-			return true
+			g.mPendingAnalysis = false
+			g.mStep = StepStamp
+			g.errMsg = ""
 		case '2':
-			g.startGame(true)
+			g.mPendingAnalysis = true
+			g.mStep = StepStamp
+			g.errMsg = ""
+		case 'd', 'D':
+			g.startDailyChallenge()
 			return true
 		case 127, 8:
 			g.mStep = StepCols
 			g.errMsg = ""
 		}
+
+	case StepStamp:
+		choices := g.stampChoices()
+		switch {
+		case ch >= '1' && int(ch-'0') <= len(choices):
+			g.stamp = choices[ch-'1']
+			g.startGame(g.mPendingAnalysis)
+			return true
+		case ch == 127 || ch == 8:
+			g.mStep = StepMode
+			g.errMsg = ""
+		}
 	}
 
-	fmt.Print(g.renderMenu())
+	g.print(g.renderMenu())
 	return true
 }
 
@@ -966,34 +1750,111 @@ func (g *Game) startGame(analysis bool) {
 	m, _ := strconv.Atoi(g.mRows)
 	n, _ := strconv.Atoi(g.mCols)
 	g.analysis = analysis
+	g.daily = false
+	g.stampMsg = ""
 	if analysis {
 		// 解析モード: (m+2)×(n+2) の盤を生成
 		g.allocBoard(m+2, n+2)
 		g.scrambleSolvableInner()
-		g.fillOuterToZeroGF4()
+		if g.stamp.GF4Compatible {
+			g.fillOuterToZeroGF4()
+		} else {
+			g.stampMsg = "このスタンプでは GF(4) 不変量が成立しないため、外周ゼロ化と GF(4) オーバーレイを無効化しました"
+		}
 	} else {
 		// 通常モード: m×n の盤を生成
 		g.allocBoard(m, n)
-		g.scrambleSolvable()
+		g.scrambleSolvable(g.rng)
 	}
 	g.mode = ModeGame
-	fmt.Print(g.renderGame())
+	g.print(g.renderGame())
+}
+
+// startDailyChallenge は m×n サイズで本日のチャレンジを開始する。
+// 乱数は sha256(日付||rows||cols) から導いたシードで決定的に生成するため、
+// 同じ日・同じサイズであれば世界中の誰でも同一の盤面になる。
+func (g *Game) startDailyChallenge() {
+	m, _ := strconv.Atoi(g.mRows)
+	n, _ := strconv.Atoi(g.mCols)
+	date := time.Now().Format("2006-01-02")
+
+	g.analysis = false
+	g.daily = true
+	g.dailyDate = date
+	g.dailyDone = false
+	g.dailyMsg = ""
+	g.stampMsg = ""
+	g.stamp = stampKing
+	g.customStamp = nil
+
+	g.allocBoard(m, n)
+	g.scrambleSolvable(rand.New(rand.NewSource(dailySeed(date, m, n))))
+	g.dailyStart = time.Now()
+	g.mode = ModeGame
+	g.print(g.renderGame())
+}
+
+// finishDailyIfSolved は本日のチャレンジ中に全消灯した時点で一度だけ呼ばれ、
+// 手数・経過時間をリーダーボードに記録して g.dailyMsg にベスト記録と
+// 連続達成日数を書き込む。
+func (g *Game) finishDailyIfSolved() {
+	if !g.daily || g.dailyDone || !g.isSolved() {
+		return
+	}
+	g.dailyDone = true
+	elapsed := time.Since(g.dailyStart)
+	best, streak, err := recordDailyResult(g.dailyDate, g.rows, g.cols, g.moves, elapsed)
+	if err != nil {
+		g.dailyMsg = "記録の保存に失敗しました: " + err.Error()
+		return
+	}
+	g.dailyMsg = fmt.Sprintf("ベスト %d 手 / %.1f 秒   連続達成 %d 日",
+		best.Moves, best.Seconds, streak)
 }
 
 func (g *Game) gameKey(b []byte) bool {
-	// 矢印キー: ESC [ A/B/C/D
-	if len(b) >= 3 && b[0] == 27 && b[1] == '[' {
-		switch b[2] {
-		case 'A':
-			g.moveCursor(-1, 0) // 上
-		case 'B':
-			g.moveCursor(1, 0) // 下
-		case 'C':
-			g.moveCursor(0, 1) // 右
-		case 'D':
-			g.moveCursor(0, -1) // 左
-		}
-		fmt.Print(g.renderGame())
+	// 移動・トグルは config.json の keys で決まる keymap を経由する。
+	// デフォルトは従来どおり hjkl/矢印キー+スペース/エンターのままだが、
+	// ユーザは再コンパイルせず vim スタイル・WASD・矢印キーを選べる。
+	switch g.keymap[keyName(b)] {
+	case "up":
+		g.moveCursor(-1, 0)
+		g.print(g.renderGame())
+		return true
+	case "down":
+		g.moveCursor(1, 0)
+		g.print(g.renderGame())
+		return true
+	case "left":
+		g.moveCursor(0, -1)
+		g.print(g.renderGame())
+		return true
+	case "right":
+		g.moveCursor(0, 1)
+		g.print(g.renderGame())
+		return true
+	case "toggle":
+		if !g.isSolved() || g.analysis {
+			single := g.analysis && g.singleToggle
+			g.pushHistory(g.curRow, g.curCol, single)
+			if single {
+				g.doSingleToggle(g.curRow, g.curCol)
+			} else {
+				g.doToggle(g.curRow, g.curCol)
+			}
+			g.moves++
+			g.hint = nil
+			g.hintMsg = ""
+			g.finishDailyIfSolved()
+			if !g.analysis && g.isSolved() {
+				audio.Play(audio.EventClear)
+			} else {
+				audio.Play(audio.EventToggle)
+			}
+		} else {
+			audio.Play(audio.EventInvalid)
+		}
+		g.print(g.renderGame())
 		return true
 	}
 
@@ -1007,48 +1868,73 @@ func (g *Game) gameKey(b []byte) bool {
 		g.mode = ModeMenu
 		g.mStep = StepMode
 		g.errMsg = ""
-		fmt.Print(g.renderMenu())
+		g.print(g.renderMenu())
 		return true
 
-	case ' ', '\r', '\n':
-		if !g.isSolved() || g.analysis {
-			g.pushHistory()
-			if g.analysis && g.singleToggle {
-				g.doSingleToggle(g.curRow, g.curCol)
-			} else {
-				g.doToggle(g.curRow, g.curCol)
-			}
-			g.moves++
-		}
+	case 'y', 25: // 25 = Ctrl-Y (一部端末では Ctrl-R がリサイズ等に占有されるため Y/Ctrl-Y を使用)
+		g.redo()
+		g.hint = nil
+		g.hintMsg = ""
 
 	case 'u', 'U':
 		g.undo()
-
-	// ── hjkl 移動 (vim スタイル) ─────────────────────────────
-	case 'h':
-		g.moveCursor(0, -1) // 左
-	case 'j':
-		g.moveCursor(1, 0) // 下
-	case 'k':
-		g.moveCursor(-1, 0) // 上
-	case 'l':
-		g.moveCursor(0, 1) // 右
+		g.hint = nil
+		g.hintMsg = ""
 
 	// ── 隠し: ゲームモードで GF(4) オーバーレイ表示を切り替え ─────────
 	case 'g', 'G':
 		if !g.analysis {
-			g.showAnalysis = !g.showAnalysis
+			if g.stamp.GF4Compatible {
+				g.showAnalysis = !g.showAnalysis
+				g.stampMsg = ""
+			} else {
+				g.stampMsg = "このスタンプでは GF(4) オーバーレイを利用できません"
+			}
 		}
 
-	// ── 解析モード専用: S/A で配置を再生成 ──────────────────────
-	case 's', 'S':
+	// ── 解析モード専用: s/a で配置を再生成 ──────────────────────
+	case 's':
 		if g.analysis {
 			g.scrambleSolvableInner()
 		} else {
-			// 通常モード: S はリスタート (解ける配置)
-			g.scrambleSolvable()
+			// 通常モード: s はリスタート (解ける配置)。デイリーチャレンジ中に
+			// 非決定的な盤面へ差し替えてしまうと、その盤面の結果をデイリーの
+			// 成績として記録してしまうため daily フラグも落とす。
+			g.daily = false
+			g.dailyMsg = ""
+			g.scrambleSolvable(g.rng)
+		}
+
+	// 解析モードでは従来どおり S でも解ける配置を再生成できる。
+	// 通常モード専用: S で保存 (L は下の読み込みとセット)。
+	case 'S':
+		if g.analysis {
+			g.scrambleSolvableInner()
+		} else {
+			if err := g.saveState(); err != nil {
+				g.saveMsg = "保存に失敗しました: " + err.Error()
+			} else {
+				g.saveMsg = "保存しました"
+			}
 		}
 
+	case 'L':
+		if !g.analysis {
+			if err := g.loadState(); err != nil {
+				g.saveMsg = "読み込みに失敗しました: " + err.Error()
+			} else {
+				g.saveMsg = "読み込みました"
+				// 保存済みの盤面は今日のデイリー盤面と一致する保証がないため、
+				// デイリーチャレンジ中の読み込みはデイリー扱いを終了させる。
+				g.daily = false
+				g.dailyMsg = ""
+			}
+		}
+
+	// ── パズルコード表示 ("C" キー) ──────────────────────────────
+	case 'c', 'C':
+		g.saveMsg = "コード: " + g.encodePuzzleCode()
+
 	case 'a', 'A':
 		if g.analysis {
 			g.scrambleArbitrary()
@@ -1066,13 +1952,51 @@ func (g *Game) gameKey(b []byte) bool {
 		if g.analysis {
 			g.clearBoard()
 			g.history = nil
+			g.redoStack = nil
 			g.moves = 0
 			g.curRow, g.curCol = 1, 1
 		}
 
 	case 'r', 'R':
 		if !g.analysis {
-			g.scrambleSolvable()
+			g.daily = false
+			g.dailyMsg = ""
+			g.scrambleSolvable(g.rng)
+			g.hint = nil
+			g.hintMsg = ""
+		}
+
+	// ── 通常モード専用: H でヒント、P で自動解答 ──────────────────
+	case 'H':
+		if !g.analysis {
+			next, ok, reason := g.hintNext()
+			if !ok {
+				g.hint = nil
+				g.hintMsg = reason
+			} else {
+				g.hint = &next
+				g.hintMsg = ""
+			}
+		}
+
+	case 'p', 'P':
+		if !g.analysis {
+			res := g.solve()
+			g.hint = nil
+			if !res.ok {
+				g.hintMsg = res.reason
+				break
+			}
+			g.hintMsg = ""
+			for _, p := range res.presses {
+				g.curRow, g.curCol = p.r, p.c
+				g.pushHistory(p.r, p.c, false)
+				g.doToggle(p.r, p.c)
+				g.moves++
+				g.print(g.renderGame())
+				time.Sleep(300 * time.Millisecond)
+			}
+			g.finishDailyIfSolved()
 		}
 
 	case '\\':
@@ -1080,78 +2004,127 @@ func (g *Game) gameKey(b []byte) bool {
 		// 解析モード中 (fromGame=true) の場合はゲームモードへ戻る
 		if !g.analysis {
 			g.enterAnalysisFromGame()
-			fmt.Print(g.renderGame())
+			g.print(g.renderGame())
 			return true
 		} else if g.fromGame {
 			g.returnToGameFromAnalysis()
-			fmt.Print(g.renderGame())
+			g.print(g.renderGame())
 			return true
 		}
 	}
 
-	fmt.Print(g.renderGame())
+	g.print(g.renderGame())
 	return true
 }
 
-// ── ターミナル取得 ─────────────────────────────────────────────
+// ── tui.Model ──────────────────────────────────────────────────
+//
+// main のローカル実行は internal/tui の Program が駆動する。raw モードの
+// 生涯・入力デコード・描画タイミングは Program 側の責務で、Game はここで
+// 満たす3メソッドで自分の状態を差し出すだけでよい。
 
-func openTerminal() (*os.File, error) {
-	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
-		return tty, nil
+// Init は tui.Model を満たす。現在のモード (--puzzle 読み込み後ならゲーム
+// 盤面、それ以外はメニュー) に応じた最初の画面を返す。
+func (g *Game) Init() string {
+	if g.mode == ModeGame {
+		return g.renderGame()
 	}
-	for n := 0; n <= 2; n++ {
-		path := fmt.Sprintf("/proc/self/fd/%d", n)
-		f, err := os.OpenFile(path, os.O_RDWR, 0)
+	return g.renderMenu()
+}
+
+// Update は tui.Model を満たす。実際のキー処理は既存の handleKey (自動
+// 再生のようにキー1回で複数フレームを自分で描画するケースも含む) に
+// そのまま委譲し、デコード結果は将来の画面が Raw を介さず使えるように
+// 残すだけにとどめる。
+func (g *Game) Update(key tui.Key) (tui.Model, bool) {
+	ok := g.handleKey(key.Raw)
+	return g, ok
+}
+
+// View は tui.Model を満たす。
+func (g *Game) View() string {
+	if g.mode == ModeGame {
+		return g.renderGame()
+	}
+	return g.renderMenu()
+}
+
+// SetOutput は tui.Model を満たす。Program から渡された描画先を以後の
+// print に使う。
+func (g *Game) SetOutput(w io.Writer) {
+	g.out = w
+}
+
+// runKeyLoop は r から読んだバイト列を handleKey に渡し続ける、SSH セッ
+// ション向けの入力ループ (ローカル実行は internal/tui の Program を使う)。
+func runKeyLoop(r io.Reader, g *Game) {
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
 		if err != nil {
-			continue
+			return
 		}
-		if term.IsTerminal(int(f.Fd())) {
-			return f, nil
+		if !g.handleKey(buf[:n]) {
+			return
 		}
-		_ = f.Close()
 	}
-	return nil, fmt.Errorf(
-		"インタラクティブなターミナルが見つかりません\n" +
-			"  ターミナルで直接 ./lightsout を実行してください",
-	)
 }
 
 // ── main ──────────────────────────────────────────────────────
 
 func main() {
-	tty, err := openTerminal()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	serveAddr := flag.String("serve", "", "SSH 経由でホストする場合の待受アドレス (例: :2222)")
+	puzzleCode := flag.String("puzzle", "", "共有されたパズルコードを読み込んで開始する")
+	stampFile := flag.String("stamp", "", "カスタムのトグルスタンプ (JSON ファイル) を読み込む")
+	dailyJSON := flag.Bool("daily-json", false, "本日のデイリーチャレンジ記録を JSON で出力して終了する")
+	mute := flag.Bool("mute", false, "効果音を無効にする")
+	flag.Parse()
+
+	if *serveAddr != "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			cfg = defaultConfig()
+		}
+		if err := serveSSH(*serveAddr, cfg.SSHHostKeyPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	defer tty.Close()
 
-	fd := int(tty.Fd())
-	oldState, err := term.MakeRaw(fd)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "raw モード設定に失敗しました:", err)
-		os.Exit(1)
+	if *dailyJSON {
+		if err := printDailyJSON(); err != nil {
+			fmt.Fprintln(os.Stderr, "デイリー記録の読み込みに失敗しました:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *mute {
+		audio.Mute()
 	}
-	defer func() {
-		_ = term.Restore(fd, oldState)
-		fmt.Print(ansiShow + ansiReset + "\r\n")
-	}()
 
-	fmt.Print(ansiHide)
 	g := newGame()
-	fmt.Print(g.renderMenu())
-
-	buf := make([]byte, 16)
-	for {
-		n, err := tty.Read(buf)
+	if *stampFile != "" {
+		st, err := loadStampFile(*stampFile)
 		if err != nil {
-			break
+			fmt.Fprintln(os.Stderr, "スタンプファイルの読み込みに失敗しました:", err)
+			os.Exit(1)
 		}
-		if !g.handleKey(buf[:n]) {
-			break
+		g.customStamp = &st
+		g.stamp = st
+	}
+	if *puzzleCode != "" {
+		if err := g.loadPuzzleCode(*puzzleCode); err != nil {
+			fmt.Fprintln(os.Stderr, "パズルコードの読み込みに失敗しました:", err)
+			os.Exit(1)
 		}
 	}
 
-	fmt.Print(ansiClear + ansiShow)
-	fmt.Print("\r\nまたね！\r\n")
+	if err := tui.NewProgram(g).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// stdout はリダイレクト先 (ログ採取など) の可能性があるため、ここも
+	// tty に直接書き込んで汚さないようにする。
+	_ = tui.Println("\r\nまたね！\r\n")
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+
+	"lightsout/internal/audio"
+)
+
+// ── マルチプレイ (SSH) ──────────────────────────────────────────
+//
+// `lightsout -serve :2222` で SSH 経由のマルチプレイサーバを起動する。
+// gliderlabs/ssh はセッションを ssh.Session (io.ReadWriter を満たし、
+// ウィンドウサイズ変更も通知する) として渡してくれるため、raw モード用の
+// 生バイト読み取りと handleKey への受け渡しは tui.Program と同じ形のまま
+// セッションごとに独立した Game へ流し込める。
+//
+// 接続直後はロビー画面で「ひとりで遊ぶ」か「レース待機」かを選べる。
+// レース待機を選んだ接続が2つ揃うと、同じ乱数シードで生成した同一盤面が
+// 両者に配られ、先に isSolved() した方が勝ちとなる。対戦相手の手数は
+// raceSession を介して共有され、一定間隔でヘッダー下に表示される。
+//
+// ホスト鍵は config.json の ssh_host_key_path で指定する。空文字列の場合は
+// gliderlabs/ssh の既定動作どおり、起動のたびに使い捨てのホスト鍵を生成する。
+
+// serveSSH は gliderlabs/ssh サーバを起動し、セッションを待ち受け続ける。
+// audio.Play は `-tags audio` ビルドではプロセス全体で共有される
+// スピーカーを鳴らす実装になっており、セッションごとのミュートの仕組みは
+// 無いため、-serve ではここで一度だけ audio.Mute() してプロセス全体を
+// ミュートする。そうしないと、接続してきた各クライアントの操作音が
+// サーバを動かしているマシン側で (しかも複数セッション分重なって) 鳴って
+// しまう。
+func serveSSH(addr, hostKeyPath string) error {
+	audio.Mute()
+	lb := newLobby()
+
+	server := &ssh.Server{
+		Addr: addr,
+		Handler: func(s ssh.Session) {
+			handleSSHSession(s, lb)
+		},
+	}
+	if hostKeyPath != "" {
+		if err := server.SetOption(ssh.HostKeyFile(hostKeyPath)); err != nil {
+			return fmt.Errorf("ホスト鍵の読み込みに失敗しました: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "lightsout -serve: %s で待機中\n", addr)
+	return server.ListenAndServe()
+}
+
+// handleSSHSession は1つの ssh.Session の生涯を処理する。PTY を要求して
+// いない接続 (`ssh host command` のような非対話実行) は対応できない旨を
+// 伝えて即座に閉じる。
+func handleSSHSession(s ssh.Session, lb *lobby) {
+	_, winCh, isPTY := s.Pty()
+	if !isPTY {
+		fmt.Fprintln(s, "対話的な PTY が必要です。ssh -t 等で接続してください")
+		return
+	}
+	go drainWindowChanges(winCh)
+
+	lw := &lockedWriter{rw: s}
+	sess := &raceSession{}
+	switch showLobby(lw, s.RemoteAddr().String(), lb) {
+	case lobbyChoiceSolo:
+		playSolo(lw)
+	case lobbyChoiceRace:
+		playRace(lw, lb, sess, s.RemoteAddr().String(), s.Context().Done())
+	}
+}
+
+// drainWindowChanges はウィンドウサイズ変更通知を読み捨てる。盤面は固定の
+// 文字幅で描画しているため現状は対応不要だが、将来リサイズに追従する際の
+// 拡張点としてチャンネルだけ引いておく。
+func drainWindowChanges(winCh <-chan ssh.Window) {
+	for range winCh {
+	}
+}
+
+// lockedWriter は同じ接続に複数ゴルーチン (ゲームループと対戦相手の手数
+// 通知ティッカー) から書き込まれる入出力を直列化する。
+type lockedWriter struct {
+	rw io.ReadWriter
+	mu sync.Mutex
+}
+
+func (w *lockedWriter) Read(p []byte) (int, error) { return w.rw.Read(p) }
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rw.Write(p)
+}
+
+type lobbyChoice int
+
+const (
+	lobbyChoiceQuit lobbyChoice = iota
+	lobbyChoiceSolo
+	lobbyChoiceRace
+)
+
+// showLobby は接続直後のロビー画面を表示し、ユーザの選択を読み取る。
+func showLobby(lw *lockedWriter, remote string, lb *lobby) lobbyChoice {
+	fmt.Fprint(lw, ansiClear+ansiHide+"\r\n")
+	fmt.Fprint(lw, ansiBold+"  LIGHTS OUT ロビー"+ansiReset+"\r\n\r\n")
+	fmt.Fprintf(lw, "  接続元: %s\r\n\r\n", remote)
+	if nick := lb.waitingNick(); nick != "" {
+		fmt.Fprintf(lw, "  待機中の対戦相手がいます (%s)\r\n", nick)
+	} else {
+		fmt.Fprint(lw, "  現在、待機中の対戦相手はいません\r\n")
+	}
+	fmt.Fprint(lw, "\r\n  "+ansiBold+"S"+ansiReset+" ひとりで遊ぶ   "+
+		ansiBold+"R"+ansiReset+" レース待機   "+
+		ansiBold+"Q"+ansiReset+" 切断\r\n")
+
+	buf := make([]byte, 1)
+	for {
+		n, err := lw.Read(buf)
+		if err != nil || n == 0 {
+			return lobbyChoiceQuit
+		}
+		switch buf[0] {
+		case 's', 'S':
+			return lobbyChoiceSolo
+		case 'r', 'R':
+			return lobbyChoiceRace
+		case 'q', 'Q', 3:
+			return lobbyChoiceQuit
+		}
+	}
+}
+
+// playSolo はロビーで「ひとりで遊ぶ」を選んだ接続を、ローカル実行と同じ
+// メニュー開始・入力ループで処理する。
+func playSolo(lw *lockedWriter) {
+	g := newGame()
+	g.out = lw
+	g.print(g.renderMenu())
+	runKeyLoop(lw, g)
+}
+
+const raceRows, raceCols = 5, 5 // レースモードは固定サイズで、待たずに即対戦できるようにする
+
+// lobby は対戦待ちのプレイヤーを1人だけ保持する。2人目が来た時点で
+// 即座にマッチングし、同じ乱数シードで両者の盤面を生成する。
+type lobby struct {
+	mu      sync.Mutex
+	waiting *raceWaiter
+}
+
+func newLobby() *lobby { return &lobby{} }
+
+type raceWaiter struct {
+	nick    string
+	sess    *raceSession
+	matchCh chan raceMatch
+	done    <-chan struct{} // 接続が切れると close される (ssh.Session.Context().Done())
+}
+
+// raceMatch は対戦成立時に両者へ配られる盤面条件。peer が nil の場合は
+// マッチング前に自分の接続が切れたことを表し、呼び出し元は対戦を諦める。
+type raceMatch struct {
+	seed int64
+	peer *raceSession
+}
+
+func (lb *lobby) waitingNick() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.waiting == nil {
+		return ""
+	}
+	return lb.waiting.nick
+}
+
+// join はレース待機列に加わる。先客がいれば即マッチングして両者に
+// raceMatch を返し、いなければ自分が待機者となって相手が来るまで待つ。
+// done は呼び出し元の接続が切れたときに close されるチャンネルで、待機中
+// (自分が先客の場合) も、新着として先客を見る場合 (相手の done) も使い、
+// 切断済みの幽霊待機者が永遠にロビーへ居座って次の相手とマッチしてしまう
+// ことのないようにする。
+func (lb *lobby) join(nick string, sess *raceSession, done <-chan struct{}) raceMatch {
+	lb.mu.Lock()
+	if lb.waiting != nil {
+		select {
+		case <-lb.waiting.done:
+			// 先客はすでに接続が切れている。幽霊待機者を捨てて自分が新たに
+			// 待機者となる。
+			lb.waiting = nil
+		default:
+		}
+	}
+	if lb.waiting == nil {
+		w := &raceWaiter{nick: nick, sess: sess, matchCh: make(chan raceMatch, 1), done: done}
+		lb.waiting = w
+		lb.mu.Unlock()
+		select {
+		case m := <-w.matchCh:
+			return m
+		case <-done:
+			lb.mu.Lock()
+			if lb.waiting == w {
+				lb.waiting = nil
+			}
+			lb.mu.Unlock()
+			return raceMatch{}
+		}
+	}
+	w := lb.waiting
+	lb.waiting = nil
+	lb.mu.Unlock()
+
+	seed := time.Now().UnixNano()
+	w.matchCh <- raceMatch{seed: seed, peer: sess}
+	return raceMatch{seed: seed, peer: w.sess}
+}
+
+// raceSession はレースモード中の1プレイヤーの進行状況を保持する。
+// 対戦相手のゴルーチンから手数・勝敗を読めるよう mu で保護する。
+type raceSession struct {
+	mu    sync.Mutex
+	moves int
+	won   bool
+}
+
+func (s *raceSession) update(moves int, won bool) {
+	s.mu.Lock()
+	s.moves, s.won = moves, won
+	s.mu.Unlock()
+}
+
+func (s *raceSession) snapshot() (moves int, won bool) {
+	s.mu.Lock()
+	moves, won = s.moves, s.won
+	s.mu.Unlock()
+	return
+}
+
+// playRace は対戦相手とのマッチングを待ち、成立したら同じ乱数シードの
+// 盤面で対戦する。自分が手を打つたびに手数を raceSession へ反映し、
+// 別ゴルーチンが一定間隔で対戦相手の手数を画面に流し込む。
+func playRace(lw *lockedWriter, lb *lobby, sess *raceSession, nick string, done <-chan struct{}) {
+	fmt.Fprint(lw, "\r\n  対戦相手を待っています...\r\n")
+	match := lb.join(nick, sess, done)
+	if match.peer == nil {
+		// 対戦相手が見つかる前に自分の接続が切れた。
+		return
+	}
+
+	g := newGame()
+	g.out = lw
+	g.rng = rand.New(rand.NewSource(match.seed))
+	g.mRows, g.mCols = strconv.Itoa(raceRows), strconv.Itoa(raceCols)
+	g.allocBoard(raceRows, raceCols)
+	g.scrambleSolvable(g.rng)
+	g.mode = ModeGame
+
+	done := make(chan struct{})
+	defer close(done)
+	go broadcastPeerMoves(lw, match.peer, done)
+
+	g.print(g.renderGame())
+
+	buf := make([]byte, 16)
+	for {
+		n, err := lw.Read(buf)
+		if err != nil {
+			return
+		}
+		if !g.handleKey(buf[:n]) {
+			return
+		}
+		won := g.isSolved()
+		sess.update(g.moves, won)
+		if won {
+			fmt.Fprint(lw, "\r\n"+ansiBold+ansiGreen+"  ★ あなたの勝ちです！ ★"+ansiReset+"\r\n")
+			return
+		}
+		if _, peerWon := match.peer.snapshot(); peerWon {
+			fmt.Fprint(lw, "\r\n"+ansiBold+ansiRed+"  相手が先に全消灯しました…"+ansiReset+"\r\n")
+			return
+		}
+	}
+}
+
+// broadcastPeerMoves はキー入力を待たずに対戦相手の進捗が分かるよう、
+// 一定間隔で相手の現在の手数を画面に流し込む。
+func broadcastPeerMoves(lw *lockedWriter, peer *raceSession, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			moves, won := peer.snapshot()
+			if won {
+				return
+			}
+			fmt.Fprintf(lw, "\r\n  相手の手数: %d\r\n", moves)
+		}
+	}
+}